@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"lookup/lookup"
+	"os"
+	"os/signal"
+)
+
+const batchUsage = `usage: msisdn-lookup batch [-i in.csv] [-o out.csv] [--format csv|xlsx|json|ndjson] [flags]
+
+Analyses a CSV file (or a plain list, one number per line) offline. CSV and
+XLSX output keep the input columns and append every lookup field. Exits 0
+when every number is valid, 1 when at least one is not (or the batch
+failed) and 2 on usage errors.
+`
+
+// runBatch implements the "batch" subcommand and returns the exit code.
+func runBatch(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, batchUsage)
+		fs.PrintDefaults()
+	}
+	input := fs.String("i", "-", "input file, - for stdin")
+	output := fs.String("o", "-", "output file, - for stdout")
+	var opts lookup.ExportOptions
+	fs.StringVar(&opts.Format, "format", "csv", "output format: csv, xlsx, json or ndjson")
+	fs.StringVar(&opts.Column, "column", "", "MSISDN column by header name or 1-based position (detected when empty)")
+	fs.StringVar(&opts.Region, "region", "", "default region for numbers without a leading +")
+	fs.BoolVar(&opts.Dedupe, "dedupe", false, "analyse each normalized number only once")
+	workers := fs.Int("workers", 0, "goroutines analysing the batch (default GOMAXPROCS)")
+	src := rulesFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	switch opts.Format {
+	case "csv", "xlsx", "json", "ndjson":
+	default:
+		fmt.Fprintf(stderr, "unknown format %q\n", opts.Format)
+		return 2
+	}
+
+	analyzer, err := lookup.Open(*src)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if opts.Region != "" && !analyzer.HasRegion(opts.Region) {
+		fmt.Fprintf(stderr, "unknown region %q\n", opts.Region)
+		return 2
+	}
+	opts.Pool = lookup.NewWorkerPool(*workers, 0)
+
+	in := stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		defer f.Close()
+		in = f
+	}
+	out := stdout
+	var file *os.File
+	if *output != "-" {
+		if file, err = os.Create(*output); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		out = file
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	summary, err := analyzer.ExportBatch(ctx, in, out, opts)
+	if file != nil {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	fmt.Fprintf(stderr, "%d entries, %d analysed, %d valid, %d invalid, %d duplicate number(s)\n",
+		summary.Entries, summary.Analyzed, summary.Valid, summary.Invalid.Total, len(summary.Duplicates))
+	if summary.Invalid.Total > 0 {
+		return 1
+	}
+	return 0
+}
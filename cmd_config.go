@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"lookup/config"
+	"os"
+)
+
+const configUsage = `usage: msisdn-lookup config print [--format yaml|json] [serve flags]
+
+Prints the configuration "serve" would run with, given the same flags,
+config file and environment, and where each non-default value came from.
+`
+
+// runConfig implements the "config" subcommand and returns the exit code.
+func runConfig(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprint(stderr, configUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, configUsage)
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", "yaml", "output format: yaml or json")
+	cfg, err := config.Load(fs, args[1:], os.LookupEnv)
+	if err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(stderr, err)
+		}
+		return 2
+	}
+	if err := cfg.Print(stdout, *format); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"lookup/config"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+const healthUsage = `usage: msisdn-lookup health [--timeout 3s] [serve flags]
+
+Asks the server started with the same flags, config file and environment
+for /readyz on its own address and path prefix. Exits 0 when it is ready
+and 1 otherwise, so it can serve as a container health check.
+`
+
+// runHealth implements the "health" subcommand and returns the exit code.
+func runHealth(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("health", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, healthUsage)
+		fs.PrintDefaults()
+	}
+	timeout := fs.Duration("timeout", 3*time.Second, "how long to wait for the answer")
+	cfg, err := config.Load(fs, args, os.LookupEnv)
+	if err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(stderr, err)
+		}
+		return 2
+	}
+
+	url, err := readyURL(cfg.Addr, cfg.PathPrefix)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	client := &http.Client{Timeout: *timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(stderr, "%s: %s %s\n", url, resp.Status, body)
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s: %s\n", url, resp.Status)
+	return 0
+}
+
+// readyURL returns the /readyz URL of a server listening on addr below
+// prefix. A wildcard or empty host is reached through the loopback address.
+func readyURL(addr, prefix string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("addr %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port) + prefix + "/readyz", nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"lookup/lookup"
+	"strings"
+)
+
+const lookupUsage = `usage: msisdn-lookup lookup [--json] [--region RS] [--rules file] <msisdn>...
+
+Analyses each number and prints the result. Exits 0 when every number is
+valid, 1 when at least one is not and 2 on usage errors.
+`
+
+// runLookup implements the "lookup" subcommand and returns the exit code.
+func runLookup(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("lookup", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, lookupUsage)
+		fs.PrintDefaults()
+	}
+	asJSON := fs.Bool("json", false, "print JSON instead of text")
+	region := fs.String("region", "", "default region for numbers without a leading +")
+	src := rulesFlags(fs)
+	numbers, err := parseInterspersed(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(numbers) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	analyzer, err := lookup.Open(*src)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if *region != "" && !analyzer.HasRegion(*region) {
+		fmt.Fprintf(stderr, "unknown region %q\n", *region)
+		return 2
+	}
+
+	code := 0
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	for i, number := range numbers {
+		res := analyzer.AnalyzeWith(number, lookup.Options{Region: *region})
+		if !res.Valid.DigitsOnly || !res.Valid.KnownCountryCode || !res.Valid.LengthOk {
+			code = 1
+		}
+		if *asJSON {
+			enc.Encode(res)
+			continue
+		}
+		if i > 0 {
+			fmt.Fprintln(stdout)
+		}
+		printLookup(stdout, res)
+	}
+	return code
+}
+
+func printLookup(w io.Writer, res lookup.LookupResponse) {
+	title := res.E164
+	if title == "" {
+		title = res.Input
+	}
+	fmt.Fprintln(w, title)
+	fmt.Fprintf(w, "  country:   %s (%s confidence)\n", res.Country, res.CountryConfidence)
+	fmt.Fprintf(w, "  type:      %s (%s confidence)\n", res.NumberType, res.TypeConfidence)
+	operator := res.Operator
+	if res.MCC != "" {
+		operator += fmt.Sprintf(", MCC %s MNC %s", res.MCC, res.MNC)
+	}
+	fmt.Fprintf(w, "  operator:  %s (%s confidence)\n", operator, res.OperatorConfidence)
+
+	var failed []string
+	if !res.Valid.DigitsOnly {
+		failed = append(failed, "contains non-digits")
+	}
+	if !res.Valid.KnownCountryCode {
+		failed = append(failed, "unknown country code")
+	}
+	if !res.Valid.LengthOk {
+		failed = append(failed, "invalid length")
+	}
+	if len(failed) == 0 {
+		fmt.Fprintln(w, "  valid:     yes")
+	} else {
+		fmt.Fprintf(w, "  valid:     no (%s)\n", strings.Join(failed, ", "))
+	}
+
+	for _, line := range []string{res.Explain.Input, res.Explain.Country, res.Explain.Type, res.Explain.Operator} {
+		if line != "" {
+			fmt.Fprintln(w, "  -", line)
+		}
+	}
+}
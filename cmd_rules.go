@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"lookup/lookup"
+)
+
+const rulesUsage = `usage: msisdn-lookup rules lint [--strict] <file>
+
+Checks a rules file for structural problems. Exits 1 when errors are found
+(or warnings, with --strict) and 2 when the file cannot be read.
+`
+
+// runRules implements the "rules" subcommand and returns the exit code.
+func runRules(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "lint" {
+		fmt.Fprint(stderr, rulesUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("rules lint", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, rulesUsage) }
+	strict := fs.Bool("strict", false, "treat warnings as errors")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	path := fs.Arg(0)
+	issues, err := lookup.LintFile(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	for _, issue := range issues {
+		fmt.Fprintln(stdout, issue)
+	}
+	if lookup.HasLintErrors(issues) || (*strict && len(issues) > 0) {
+		fmt.Fprintf(stderr, "%s: %d issue(s)\n", path, len(issues))
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s: ok (%d warning(s))\n", path, len(issues))
+	return 0
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"lookup/config"
+	"lookup/lookup"
+	"lookup/web"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const serveUsage = `usage: msisdn-lookup serve [flags]
+
+Runs the HTTP server. Settings come from the defaults, then the -config
+file, then LOOKUP_* environment variables, then flags; later sources win.
+Flags:
+`
+
+// runServe implements the "serve" subcommand (also the default when the
+// binary is started without one) and returns the exit code.
+func runServe(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, serveUsage)
+		fs.PrintDefaults()
+	}
+	cfg, err := config.Load(fs, args, os.LookupEnv)
+	if err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(stderr, err)
+		}
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	logger := newLogger(stderr, cfg.Log.Level, cfg.Log.Format)
+	slog.SetDefault(logger)
+
+	analyzer, err := lookup.Open(lookup.Source{Path: cfg.Rules.Path, Overlay: cfg.Rules.Overlay})
+	if err != nil {
+		logger.Error("unable to load rules", "error", err)
+		return 1
+	}
+	logRuleWarnings(logger, analyzer)
+	lookup.SetDefault(analyzer)
+	lookup.SetBatchLimits(lookup.BatchLimits{MaxBytes: cfg.Batch.MaxBytes, MaxUploadBytes: cfg.Batch.MaxUploadBytes})
+	pool := lookup.NewWorkerPool(cfg.Batch.Workers, cfg.Batch.WorkersPerRequest)
+	lookup.SetDefaultWorkerPool(pool)
+	status := analyzer.Status()
+	logger.Info("rules loaded", "source", status.Source, "path", status.Path, "checksum", status.Checksum)
+
+	// Listen before starting anything else so a taken port fails fast.
+	ln, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		logger.Error("unable to listen", "addr", cfg.Addr, "error", err)
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	mux := http.NewServeMux()
+	if cfg.Features.WebUI {
+		mux.HandleFunc("/", web.IndexHandler)
+		mux.HandleFunc("/lookup-view", web.LookupViewHandler)
+		mux.HandleFunc("/batch-view", web.BatchViewHandler)
+		mux.HandleFunc("/static/", web.StaticHandler)
+	}
+	mux.HandleFunc("/lookup", lookup.Handler)
+	mux.HandleFunc("/batch", lookup.BatchHandler)
+	mux.HandleFunc("/batch/export", lookup.ExportHandler)
+	mux.HandleFunc("/rules/status", lookup.StatusHandler)
+	mux.HandleFunc("/openapi.json", lookup.OpenAPIHandler)
+	mux.HandleFunc("/healthz", lookup.HealthzHandler)
+	mux.HandleFunc("/readyz", lookup.ReadyzHandler)
+	mux.HandleFunc("/version", lookup.VersionHandler)
+	if cfg.Features.Metrics {
+		mux.HandleFunc("/metrics", lookup.MetricsHandler)
+	}
+	if cfg.Features.Reload {
+		mux.HandleFunc("/admin/reload", lookup.ReloadHandler)
+		go reloadOnSighup(logger)
+	}
+	api := lookup.NewAPI(analyzer)
+	api.Pool = pool
+	api.Register(mux)
+
+	var jobs *lookup.JobManager
+	if cfg.Features.Jobs {
+		var jobStore lookup.JobStore = lookup.NewMemoryJobStore(cfg.Jobs.MemoryMaxBytes)
+		if cfg.Jobs.Dir != "" {
+			if jobStore, err = lookup.NewFileJobStore(cfg.Jobs.Dir); err != nil {
+				logger.Error("unable to open job store", "error", err)
+				ln.Close()
+				return 1
+			}
+		}
+		jobs = lookup.NewJobManager(analyzer, jobStore, lookup.JobConfig{
+			Workers:   cfg.Jobs.Workers,
+			Retention: time.Duration(cfg.Jobs.Retention),
+			MaxUpload: cfg.Jobs.MaxUpload,
+		})
+		jobs.Register(mux)
+		go jobs.RunExpiry(ctx, time.Minute, func(err error) {
+			logger.Error("job expiry failed", "error", err)
+		})
+	}
+
+	if cfg.History.File != "" {
+		history, err := lookup.OpenHistory(lookup.HistoryConfig{
+			Path:       cfg.History.File,
+			Retention:  time.Duration(cfg.History.Retention),
+			Mask:       lookup.MaskPolicy{Mode: cfg.History.Mask, Salt: cfg.Log.MaskSalt},
+			MaxEntries: cfg.History.MaxEntries,
+			OnError: func(err error) {
+				logger.Error("unable to record lookup history", "error", err)
+			},
+		})
+		if err != nil {
+			logger.Error("unable to open lookup history", "error", err)
+			ln.Close()
+			return 1
+		}
+		defer history.Close()
+		lookup.SetHistory(history)
+		history.Register(mux)
+		if cfg.Features.WebUI {
+			mux.HandleFunc("/history", web.HistoryHandler)
+		}
+		go history.RunExpiry(ctx, time.Minute, func(err error) {
+			logger.Error("history expiry failed", "error", err)
+		})
+	}
+
+	if cfg.Features.WatchRules {
+		go lookup.WatchRules(ctx, time.Duration(cfg.Rules.WatchInterval), func(err error) {
+			logger.Error("rules reload rejected, keeping previous rules", "error", err)
+		})
+	}
+
+	var handler http.Handler = mux
+	if auth, err := newAuth(cfg.Auth); err != nil {
+		logger.Error("unable to load API keys", "error", err)
+		ln.Close()
+		return 1
+	} else if auth != nil {
+		handler = auth.Wrap(mux)
+		logger.Info("API key authentication enabled")
+	}
+	handler = lookup.Instrument(handler)
+	if cfg.Log.Access {
+		handler = lookup.AccessLog(logger, lookup.MaskPolicy{Mode: cfg.Log.Mask, Salt: cfg.Log.MaskSalt}, handler)
+	}
+	server := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           withPathPrefix(cfg.PathPrefix, handler),
+		ReadHeaderTimeout: time.Duration(cfg.Timeouts.ReadHeader),
+		ReadTimeout:       time.Duration(cfg.Timeouts.Read),
+		WriteTimeout:      time.Duration(cfg.Timeouts.Write),
+		IdleTimeout:       time.Duration(cfg.Timeouts.Idle),
+	}
+	var drain []func(context.Context) error
+	if jobs != nil {
+		drain = append(drain, jobs.Shutdown)
+	}
+	logger.Info("listening", "addr", ln.Addr().String(), "pathPrefix", cfg.PathPrefix)
+	if err := serve(ctx, server, ln, time.Duration(cfg.Timeouts.Shutdown), logger, drain...); err != nil {
+		logger.Error("server stopped", "error", err)
+		return 1
+	}
+	logger.Info("server stopped")
+	return 0
+}
+
+// serve runs server on ln until ctx ends, then stops accepting connections
+// and gives in-flight requests and the drain functions (e.g. background
+// jobs) up to grace to finish. Connections still open after that are closed.
+func serve(ctx context.Context, server *http.Server, ln net.Listener, grace time.Duration, logger *slog.Logger, drain ...func(context.Context) error) error {
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(ln) }()
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down", "timeout", grace.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		server.Close()
+		err = fmt.Errorf("requests still running after %s: %w", grace, err)
+	}
+	for _, fn := range drain {
+		if derr := fn(shutdownCtx); derr != nil {
+			err = errors.Join(err, fmt.Errorf("background work still running after %s: %w", grace, derr))
+		}
+	}
+	if serr := <-served; serr != http.ErrServerClosed {
+		err = errors.Join(err, serr)
+	}
+	return err
+}
+
+// newAuth builds the authenticator from the keys file and the inline keys,
+// or returns nil when no key is configured.
+func newAuth(cfg config.Auth) (*lookup.Auth, error) {
+	keys, err := lookup.ParseAPIKeys(cfg.Keys)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.KeysFile != "" {
+		fromFile, err := lookup.LoadAPIKeys(cfg.KeysFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, fromFile...)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return lookup.NewAuth(lookup.AuthConfig{
+		Keys:          keys,
+		RatePerMinute: cfg.RatePerMinute,
+		Burst:         cfg.Burst,
+		DailyQuota:    cfg.DailyQuota,
+	})
+}
+
+// withPathPrefix serves h below prefix (e.g. "/msisdn") and redirects the
+// bare prefix to prefix+"/" so the UI's relative links resolve.
+func withPathPrefix(prefix string, h http.Handler) http.Handler {
+	if prefix == "" {
+		return h
+	}
+	mux := http.NewServeMux()
+	mux.Handle(prefix+"/", http.StripPrefix(prefix, h))
+	mux.HandleFunc(prefix, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, prefix+"/", http.StatusMovedPermanently)
+	})
+	return mux
+}
+
+func newLogger(w io.Writer, level, format string) *slog.Logger {
+	var lvl slog.Level
+	lvl.UnmarshalText([]byte(strings.ToUpper(level)))
+	opts := &slog.HandlerOptions{Level: lvl}
+	if format == "text" {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+// reloadOnSighup reloads the rules file each time the process receives SIGHUP.
+func reloadOnSighup(logger *slog.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := lookup.ReloadRules(); err != nil {
+			logger.Error("rules reload rejected, keeping previous rules", "error", err)
+			continue
+		}
+		logger.Info("rules reloaded")
+		logRuleWarnings(logger, lookup.Default())
+	}
+}
+
+// logRuleWarnings logs the conflicts found in the rules analyzer serves. The
+// lookup package never prints them itself.
+func logRuleWarnings(logger *slog.Logger, analyzer *lookup.Analyzer) {
+	for _, warning := range analyzer.Warnings() {
+		logger.Warn("rules warning", "warning", warning)
+	}
+}
@@ -0,0 +1,467 @@
+// Package config assembles the server configuration from defaults, an
+// optional YAML or JSON file, LOOKUP_* environment variables and command
+// line flags, in that order of precedence (later sources win).
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every server setting. The yaml tags double as the keys shown
+// by "config print" and accepted in config files.
+type Config struct {
+	// Addr is the listen address.
+	Addr string `yaml:"addr" json:"addr"`
+	// PathPrefix mounts every route below a prefix such as "/msisdn" for
+	// deployments behind a reverse proxy that does not strip it.
+	PathPrefix string `yaml:"pathPrefix" json:"pathPrefix"`
+
+	Rules    Rules    `yaml:"rules" json:"rules"`
+	Batch    Batch    `yaml:"batch" json:"batch"`
+	Jobs     Jobs     `yaml:"jobs" json:"jobs"`
+	Timeouts Timeouts `yaml:"timeouts" json:"timeouts"`
+	Log      Log      `yaml:"log" json:"log"`
+	Auth     Auth     `yaml:"auth" json:"auth"`
+	History  History  `yaml:"history" json:"history"`
+	Features Features `yaml:"features" json:"features"`
+}
+
+type Rules struct {
+	Path    string `yaml:"path" json:"path"`
+	Overlay bool   `yaml:"overlay" json:"overlay"`
+	// WatchInterval is how often the rules file is checked for changes.
+	WatchInterval Duration `yaml:"watchInterval" json:"watchInterval"`
+}
+
+type Batch struct {
+	MaxBytes          int64 `yaml:"maxBytes" json:"maxBytes"`
+	MaxUploadBytes    int64 `yaml:"maxUploadBytes" json:"maxUploadBytes"`
+	Workers           int   `yaml:"workers" json:"workers"`
+	WorkersPerRequest int   `yaml:"workersPerRequest" json:"workersPerRequest"`
+}
+
+type Jobs struct {
+	Dir       string   `yaml:"dir" json:"dir"`
+	Workers   int      `yaml:"workers" json:"workers"`
+	Retention Duration `yaml:"retention" json:"retention"`
+	// MaxUpload is 0 for 512 MB with Dir set, or batch.maxUploadBytes
+	// while jobs are kept in memory.
+	MaxUpload int64 `yaml:"maxUploadBytes" json:"maxUploadBytes"`
+	// MemoryMaxBytes caps the inputs and results of the jobs kept in
+	// memory, when Dir is not set.
+	MemoryMaxBytes int64 `yaml:"memoryMaxBytes" json:"memoryMaxBytes"`
+}
+
+type Timeouts struct {
+	ReadHeader Duration `yaml:"readHeader" json:"readHeader"`
+	Read       Duration `yaml:"read" json:"read"`
+	Write      Duration `yaml:"write" json:"write"`
+	Idle       Duration `yaml:"idle" json:"idle"`
+	// Shutdown bounds how long in-flight requests and jobs may take to
+	// finish after SIGTERM or SIGINT.
+	Shutdown Duration `yaml:"shutdown" json:"shutdown"`
+}
+
+type Log struct {
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level" json:"level"`
+	// Format is json or text.
+	Format string `yaml:"format" json:"format"`
+	// Access writes one record per HTTP request.
+	Access bool `yaml:"access" json:"access"`
+	// Mask is how MSISDNs are logged: partial (country code and last two
+	// digits), hash (salted HMAC) or none.
+	Mask string `yaml:"mask" json:"mask"`
+	// MaskSalt keys the hash policy. Print never shows it.
+	MaskSalt string `yaml:"maskSalt" json:"maskSalt"`
+}
+
+// Auth turns on API key authentication as soon as KeysFile or Keys names a
+// key.
+type Auth struct {
+	// KeysFile is a JSON file of keys with optional per-key limits.
+	KeysFile string `yaml:"keysFile" json:"keysFile"`
+	// Keys are "name:key" pairs separated by commas. Print never shows them.
+	Keys string `yaml:"keys" json:"keys"`
+	// RatePerMinute and Burst size each key's token bucket.
+	RatePerMinute int `yaml:"ratePerMinute" json:"ratePerMinute"`
+	Burst         int `yaml:"burst" json:"burst"`
+	// DailyQuota caps requests per key and UTC day; 0 means no quota.
+	DailyQuota int `yaml:"dailyQuota" json:"dailyQuota"`
+}
+
+// History records single lookups on the server once File is set.
+type History struct {
+	// File is the append-only history file.
+	File string `yaml:"file" json:"file"`
+	// Retention is how long entries are kept; 0 keeps them forever.
+	Retention Duration `yaml:"retention" json:"retention"`
+	// Mask is how numbers are stored, like log.mask; hash uses
+	// log.maskSalt.
+	Mask string `yaml:"mask" json:"mask"`
+	// MaxEntries is how many of the newest entries are kept in memory and
+	// searched; older ones stay in the file until they expire.
+	MaxEntries int `yaml:"maxEntries" json:"maxEntries"`
+}
+
+type Features struct {
+	// WebUI serves the HTML pages on / and /lookup-view.
+	WebUI bool `yaml:"webUI" json:"webUI"`
+	// Jobs enables the asynchronous /jobs endpoints.
+	Jobs bool `yaml:"jobs" json:"jobs"`
+	// Reload enables POST /admin/reload and reloading on SIGHUP.
+	Reload bool `yaml:"reload" json:"reload"`
+	// WatchRules reloads the rules file when it changes on disk.
+	WatchRules bool `yaml:"watchRules" json:"watchRules"`
+	// Metrics serves Prometheus metrics on /metrics.
+	Metrics bool `yaml:"metrics" json:"metrics"`
+}
+
+// Default returns the built-in settings.
+func Default() Config {
+	return Config{
+		Addr:  ":9090",
+		Rules: Rules{WatchInterval: Duration(2 * time.Second)},
+		Batch: Batch{MaxBytes: 1 << 20, MaxUploadBytes: 32 << 20},
+		Jobs:  Jobs{Workers: 2, Retention: Duration(24 * time.Hour), MemoryMaxBytes: 256 << 20},
+		Timeouts: Timeouts{
+			ReadHeader: Duration(5 * time.Second),
+			Read:       Duration(5 * time.Minute),
+			Write:      Duration(10 * time.Minute),
+			Idle:       Duration(2 * time.Minute),
+			Shutdown:   Duration(30 * time.Second),
+		},
+		Log:      Log{Level: "info", Format: "json", Access: true, Mask: "partial"},
+		Auth:     Auth{RatePerMinute: 600, Burst: 60},
+		History:  History{Retention: Duration(30 * 24 * time.Hour), Mask: "partial", MaxEntries: 100000},
+		Features: Features{WebUI: true, Jobs: true, Reload: true, WatchRules: true, Metrics: true},
+	}
+}
+
+// Validate reports settings that cannot work.
+func (c *Config) Validate() error {
+	var problems []string
+	if c.PathPrefix != "" && (!strings.HasPrefix(c.PathPrefix, "/") || strings.HasSuffix(c.PathPrefix, "/")) {
+		problems = append(problems, fmt.Sprintf("pathPrefix %q must start and must not end with /", c.PathPrefix))
+	}
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("log.level %q must be debug, info, warn or error", c.Log.Level))
+	}
+	switch c.Log.Format {
+	case "json", "text":
+	default:
+		problems = append(problems, fmt.Sprintf("log.format %q must be json or text", c.Log.Format))
+	}
+	for _, m := range []struct{ key, mask string }{{"log.mask", c.Log.Mask}, {"history.mask", c.History.Mask}} {
+		switch m.mask {
+		case "partial", "none":
+		case "hash":
+			if c.Log.MaskSalt == "" {
+				problems = append(problems, m.key+" hash needs log.maskSalt")
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("%s %q must be partial, hash or none", m.key, m.mask))
+		}
+	}
+	if c.Batch.MaxBytes <= 0 || c.Batch.MaxUploadBytes <= 0 || c.Jobs.MemoryMaxBytes <= 0 || c.History.MaxEntries <= 0 {
+		problems = append(problems, "size limits must be positive")
+	}
+	if c.Auth.RatePerMinute <= 0 || c.Auth.Burst <= 0 || c.Auth.DailyQuota < 0 {
+		problems = append(problems, "auth.ratePerMinute and auth.burst must be positive, auth.dailyQuota not negative")
+	}
+	if c.Batch.Workers < 0 || c.Batch.WorkersPerRequest < 0 || c.Jobs.Workers < 0 {
+		problems = append(problems, "worker counts must not be negative")
+	}
+	if c.Features.WatchRules && c.Rules.WatchInterval <= 0 {
+		problems = append(problems, "rules.watchInterval must be positive while features.watchRules is on")
+	}
+	if c.Timeouts.Shutdown < 0 || c.History.Retention < 0 || c.Jobs.MaxUpload < 0 {
+		problems = append(problems, "timeouts.shutdown, history.retention and jobs.maxUploadBytes must not be negative")
+	}
+	if len(problems) > 0 {
+		return errors.New("config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Duration is a time.Duration written as "30s" or "2h" in files, env vars
+// and flags.
+type Duration time.Duration
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+func (d *Duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalYAML() (any, error) { return d.String(), nil }
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error { return d.Set(node.Value) }
+
+func (d Duration) MarshalText() ([]byte, error) { return []byte(d.String()), nil }
+
+func (d *Duration) UnmarshalText(text []byte) error { return d.Set(string(text)) }
+
+// Load returns the effective configuration for args. It registers one flag
+// per setting on fs, plus -config naming the file to read (env
+// LOOKUP_CONFIG). getenv is usually os.LookupEnv. Positional arguments are
+// left in fs.Args().
+func Load(fs *flag.FlagSet, args []string, getenv func(string) (string, bool)) (*Effective, error) {
+	eff := &Effective{Config: Default(), Origins: map[string]string{}}
+	for _, s := range settings {
+		eff.Origins[s.key] = "default"
+	}
+
+	path, _ := getenv("LOOKUP_CONFIG")
+	if p, ok := scanConfigFlag(args); ok {
+		path = p
+	}
+	fs.String("config", path, "YAML or JSON config file (env LOOKUP_CONFIG)")
+	if path != "" {
+		if err := eff.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if s.env == "" {
+			continue
+		}
+		value, ok := getenv(s.env)
+		if !ok {
+			continue
+		}
+		if err := s.set(&eff.Config, value); err != nil {
+			return nil, fmt.Errorf("config: %s: %w", s.env, err)
+		}
+		eff.Origins[s.key] = "env " + s.env
+	}
+	if mode, ok := getenv("LOOKUP_RULES_MODE"); ok {
+		eff.Rules.Overlay = strings.EqualFold(mode, "overlay")
+		eff.Origins["rules.overlay"] = "env LOOKUP_RULES_MODE"
+	}
+
+	for _, s := range settings {
+		fs.Var(&flagValue{s: s, eff: eff}, s.flag, s.help+envHint(s))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := eff.Validate(); err != nil {
+		return nil, err
+	}
+	return eff, nil
+}
+
+// Effective is a loaded configuration plus where each value came from.
+type Effective struct {
+	Config
+	// File is the config file that was read, if any.
+	File string
+	// Origins maps each setting key to "default", "file", "env NAME" or
+	// "flag -name".
+	Origins map[string]string
+}
+
+func (e *Effective) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	// JSON is valid YAML, so one decoder serves both formats.
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&e.Config); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+
+	for _, s := range settings {
+		if hasKey(raw, s.key) {
+			e.Origins[s.key] = "file"
+		}
+	}
+	e.File = path
+	return nil
+}
+
+func hasKey(raw map[string]any, key string) bool {
+	head, rest, nested := strings.Cut(key, ".")
+	value, ok := raw[head]
+	if !ok || !nested {
+		return ok
+	}
+	child, ok := value.(map[string]any)
+	return ok && hasKey(child, rest)
+}
+
+// scanConfigFlag finds -config before the flags are parsed, because the
+// file has to be applied before env vars and flags override it.
+func scanConfigFlag(args []string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value, true
+		}
+		if i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+func envHint(s setting) string {
+	if s.env == "" {
+		return ""
+	}
+	return " (env " + s.env + ")"
+}
+
+type flagValue struct {
+	s   setting
+	eff *Effective
+}
+
+func (f *flagValue) String() string {
+	if f.eff == nil {
+		return ""
+	}
+	return f.s.get(&f.eff.Config)
+}
+
+func (f *flagValue) Set(value string) error {
+	if err := f.s.set(&f.eff.Config, value); err != nil {
+		return err
+	}
+	f.eff.Origins[f.s.key] = "flag -" + f.s.flag
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	_, ok := f.s.field(&Config{}).(*bool)
+	return ok
+}
+
+// setting binds one Config field to its file key, flag and env var.
+type setting struct {
+	key, flag, env, help string
+	field                func(*Config) any
+}
+
+func (s setting) set(c *Config, value string) error {
+	switch p := s.field(c).(type) {
+	case *string:
+		*p = value
+	case *bool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*p = v
+	case *int:
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*p = v
+	case *int64:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		*p = v
+	case *Duration:
+		return p.Set(value)
+	}
+	return nil
+}
+
+func (s setting) get(c *Config) string {
+	return fmt.Sprint(deref(s.field(c)))
+}
+
+func deref(p any) any {
+	switch p := p.(type) {
+	case *string:
+		return *p
+	case *bool:
+		return *p
+	case *int:
+		return *p
+	case *int64:
+		return *p
+	case *Duration:
+		return *p
+	}
+	return nil
+}
+
+// settings lists every configurable value. Existing env names
+// (LOOKUP_RULES_PATH, LOOKUP_RULES_MODE) are kept for compatibility.
+var settings = []setting{
+	{"addr", "addr", "LOOKUP_ADDR", "address to listen on", func(c *Config) any { return &c.Addr }},
+	{"pathPrefix", "path-prefix", "LOOKUP_PATH_PREFIX", "serve every route below this prefix, e.g. /msisdn", func(c *Config) any { return &c.PathPrefix }},
+	{"rules.path", "rules", "LOOKUP_RULES_PATH", "external rules file (default: embedded rules)", func(c *Config) any { return &c.Rules.Path }},
+	{"rules.overlay", "rules-overlay", "", "merge the rules file on top of the embedded rules (env LOOKUP_RULES_MODE=overlay)", func(c *Config) any { return &c.Rules.Overlay }},
+	{"rules.watchInterval", "rules-watch-interval", "LOOKUP_RULES_WATCH_INTERVAL", "how often the rules file is checked for changes", func(c *Config) any { return &c.Rules.WatchInterval }},
+	{"batch.maxBytes", "batch-max-bytes", "LOOKUP_BATCH_MAX_BYTES", "largest text or JSON batch body", func(c *Config) any { return &c.Batch.MaxBytes }},
+	{"batch.maxUploadBytes", "batch-max-upload-bytes", "LOOKUP_BATCH_MAX_UPLOAD_BYTES", "largest multipart batch upload", func(c *Config) any { return &c.Batch.MaxUploadBytes }},
+	{"batch.workers", "batch-workers", "LOOKUP_BATCH_WORKERS", "goroutines analysing batch entries across all requests (0: GOMAXPROCS)", func(c *Config) any { return &c.Batch.Workers }},
+	{"batch.workersPerRequest", "batch-workers-per-request", "LOOKUP_BATCH_WORKERS_PER_REQUEST", "cap on batch workers used by a single request (0: all of them)", func(c *Config) any { return &c.Batch.WorkersPerRequest }},
+	{"jobs.dir", "jobs-dir", "LOOKUP_JOBS_DIR", "keep batch jobs in this directory instead of memory", func(c *Config) any { return &c.Jobs.Dir }},
+	{"jobs.workers", "job-workers", "LOOKUP_JOB_WORKERS", "batch jobs processed at the same time", func(c *Config) any { return &c.Jobs.Workers }},
+	{"jobs.retention", "job-retention", "LOOKUP_JOB_RETENTION", "how long finished jobs and their results are kept", func(c *Config) any { return &c.Jobs.Retention }},
+	{"jobs.maxUploadBytes", "job-max-upload-bytes", "LOOKUP_JOB_MAX_UPLOAD_BYTES", "largest job upload (0: 512 MB with jobs.dir, batch.maxUploadBytes in memory)", func(c *Config) any { return &c.Jobs.MaxUpload }},
+	{"jobs.memoryMaxBytes", "job-memory-max-bytes", "LOOKUP_JOB_MEMORY_MAX_BYTES", "total size of the inputs and results of jobs kept in memory", func(c *Config) any { return &c.Jobs.MemoryMaxBytes }},
+	{"timeouts.readHeader", "read-header-timeout", "LOOKUP_READ_HEADER_TIMEOUT", "time allowed to read request headers", func(c *Config) any { return &c.Timeouts.ReadHeader }},
+	{"timeouts.read", "read-timeout", "LOOKUP_READ_TIMEOUT", "time allowed to read a whole request", func(c *Config) any { return &c.Timeouts.Read }},
+	{"timeouts.write", "write-timeout", "LOOKUP_WRITE_TIMEOUT", "time allowed to write a response", func(c *Config) any { return &c.Timeouts.Write }},
+	{"timeouts.idle", "idle-timeout", "LOOKUP_IDLE_TIMEOUT", "how long idle keep-alive connections stay open", func(c *Config) any { return &c.Timeouts.Idle }},
+	{"timeouts.shutdown", "shutdown-timeout", "LOOKUP_SHUTDOWN_TIMEOUT", "how long to drain requests and jobs on SIGTERM/SIGINT", func(c *Config) any { return &c.Timeouts.Shutdown }},
+	{"log.level", "log-level", "LOOKUP_LOG_LEVEL", "debug, info, warn or error", func(c *Config) any { return &c.Log.Level }},
+	{"log.format", "log-format", "LOOKUP_LOG_FORMAT", "json or text", func(c *Config) any { return &c.Log.Format }},
+	{"log.access", "access-log", "LOOKUP_ACCESS_LOG", "log every HTTP request", func(c *Config) any { return &c.Log.Access }},
+	{"log.mask", "log-mask", "LOOKUP_LOG_MASK", "how MSISDNs are logged: partial, hash or none", func(c *Config) any { return &c.Log.Mask }},
+	{"log.maskSalt", "log-mask-salt", "LOOKUP_LOG_MASK_SALT", "secret salt for -log-mask hash", func(c *Config) any { return &c.Log.MaskSalt }},
+	{"auth.keysFile", "api-keys-file", "LOOKUP_API_KEYS_FILE", "JSON file of API keys; enables authentication", func(c *Config) any { return &c.Auth.KeysFile }},
+	{"auth.keys", "api-keys", "LOOKUP_API_KEYS", "API keys as name:key,name:key; enables authentication", func(c *Config) any { return &c.Auth.Keys }},
+	{"auth.ratePerMinute", "api-rate", "LOOKUP_API_RATE", "requests per minute allowed per key", func(c *Config) any { return &c.Auth.RatePerMinute }},
+	{"auth.burst", "api-burst", "LOOKUP_API_BURST", "requests a key may send at once", func(c *Config) any { return &c.Auth.Burst }},
+	{"auth.dailyQuota", "api-daily-quota", "LOOKUP_API_DAILY_QUOTA", "requests per key and UTC day (0: unlimited)", func(c *Config) any { return &c.Auth.DailyQuota }},
+	{"history.file", "history-file", "LOOKUP_HISTORY_FILE", "record single lookups in this file and serve /history", func(c *Config) any { return &c.History.File }},
+	{"history.retention", "history-retention", "LOOKUP_HISTORY_RETENTION", "how long history entries are kept (0: forever)", func(c *Config) any { return &c.History.Retention }},
+	{"history.mask", "history-mask", "LOOKUP_HISTORY_MASK", "how MSISDNs are stored in the history: partial, hash or none", func(c *Config) any { return &c.History.Mask }},
+	{"history.maxEntries", "history-max-entries", "LOOKUP_HISTORY_MAX_ENTRIES", "how many of the newest history entries are kept in memory and searched", func(c *Config) any { return &c.History.MaxEntries }},
+	{"features.webUI", "web-ui", "LOOKUP_WEB_UI", "serve the HTML pages", func(c *Config) any { return &c.Features.WebUI }},
+	{"features.jobs", "jobs", "LOOKUP_JOBS", "enable the asynchronous /jobs endpoints", func(c *Config) any { return &c.Features.Jobs }},
+	{"features.reload", "reload", "LOOKUP_RELOAD", "enable POST /admin/reload and reloading on SIGHUP", func(c *Config) any { return &c.Features.Reload }},
+	{"features.watchRules", "watch-rules", "LOOKUP_WATCH_RULES", "reload the rules file when it changes", func(c *Config) any { return &c.Features.WatchRules }},
+	{"features.metrics", "metrics", "LOOKUP_METRICS", "serve Prometheus metrics on /metrics", func(c *Config) any { return &c.Features.Metrics }},
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := values[key]
+		return v, ok
+	}
+}
+
+func load(t *testing.T, args []string, vars map[string]string) (*Effective, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return Load(fs, args, env(vars))
+}
+
+func TestLoadAppliesFileThenEnvThenFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lookup.yaml")
+	os.WriteFile(path, []byte("addr: \":8000\"\npathPrefix: /msisdn\nbatch:\n  workers: 3\n  maxBytes: 2048\njobs:\n  retention: 2h\n"), 0o644)
+
+	cfg, err := load(t, []string{"-config", path, "-addr", ":7000"}, map[string]string{
+		"LOOKUP_ADDR":          ":9000",
+		"LOOKUP_BATCH_WORKERS": "5",
+		"LOOKUP_RULES_MODE":    "overlay",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Addr != ":7000" || cfg.Origins["addr"] != "flag -addr" {
+		t.Fatalf("flags should win, got %q from %s", cfg.Addr, cfg.Origins["addr"])
+	}
+	if cfg.Batch.Workers != 5 || cfg.Origins["batch.workers"] != "env LOOKUP_BATCH_WORKERS" {
+		t.Fatalf("env should override the file, got %d from %s", cfg.Batch.Workers, cfg.Origins["batch.workers"])
+	}
+	if cfg.Batch.MaxBytes != 2048 || cfg.PathPrefix != "/msisdn" || time.Duration(cfg.Jobs.Retention) != 2*time.Hour || cfg.Origins["jobs.retention"] != "file" {
+		t.Fatalf("file values not applied: %+v", cfg.Config)
+	}
+	if !cfg.Rules.Overlay {
+		t.Fatal("LOOKUP_RULES_MODE=overlay should still select overlay mode")
+	}
+	if cfg.Jobs.Workers != 2 || cfg.Origins["jobs.workers"] != "default" {
+		t.Fatalf("untouched settings keep their defaults, got %d from %s", cfg.Jobs.Workers, cfg.Origins["jobs.workers"])
+	}
+}
+
+func TestLoadRejectsUnknownKeysAndInvalidValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lookup.json")
+	os.WriteFile(path, []byte(`{"batch": {"wokers": 4}}`), 0o644)
+	if _, err := load(t, []string{"--config=" + path}, nil); err == nil || !strings.Contains(err.Error(), "wokers") {
+		t.Fatalf("expected unknown key to be reported, got %v", err)
+	}
+
+	if _, err := load(t, nil, map[string]string{"LOOKUP_READ_TIMEOUT": "soon"}); err == nil {
+		t.Fatal("expected an invalid duration to be rejected")
+	}
+	if _, err := load(t, []string{"-path-prefix", "msisdn/"}, nil); err == nil {
+		t.Fatal("expected an invalid path prefix to be rejected")
+	}
+	for _, interval := range []string{"0s", "-1s"} {
+		if _, err := load(t, []string{"-rules-watch-interval", interval}, nil); err == nil || !strings.Contains(err.Error(), "watchInterval") {
+			t.Fatalf("expected watch interval %s to be rejected, got %v", interval, err)
+		}
+	}
+	if _, err := load(t, []string{"-rules-watch-interval", "0s", "-watch-rules=false"}, nil); err != nil {
+		t.Fatalf("the interval does not matter without watching: %v", err)
+	}
+}
+
+func TestPrintAnnotatesOrigins(t *testing.T) {
+	cfg, err := load(t, []string{"-log-level", "debug"}, map[string]string{"LOOKUP_JOBS": "false"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := cfg.Print(&out, "yaml"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"level: debug # flag -log-level", "jobs: false # env LOOKUP_JOBS", "addr: :9090\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %q in:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestMaskSaltIsRequiredAndNeverPrinted(t *testing.T) {
+	if _, err := load(t, []string{"-log-mask", "hash"}, nil); err == nil || !strings.Contains(err.Error(), "maskSalt") {
+		t.Fatalf("expected hash masking without a salt to be rejected, got %v", err)
+	}
+
+	cfg, err := load(t, []string{"-log-mask", "hash"}, map[string]string{"LOOKUP_LOG_MASK_SALT": "pepper"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{"yaml", "json"} {
+		var out bytes.Buffer
+		if err := cfg.Print(&out, format); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(out.String(), "pepper") || !strings.Contains(out.String(), "<redacted>") {
+			t.Fatalf("%s output should redact the salt:\n%s", format, out.String())
+		}
+	}
+	if cfg.Log.MaskSalt != "pepper" {
+		t.Fatal("printing must not change the effective salt")
+	}
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Print writes the effective configuration as "yaml" (values not taken from
+// the defaults are annotated with their origin) or "json".
+func (e *Effective) Print(w io.Writer, format string) error {
+	cfg := e.Config
+	if cfg.Log.MaskSalt != "" {
+		cfg.Log.MaskSalt = "<redacted>"
+	}
+	if cfg.Auth.Keys != "" {
+		cfg.Auth.Keys = "<redacted>"
+	}
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(struct {
+			File    string            `json:"file,omitempty"`
+			Config  Config            `json:"config"`
+			Origins map[string]string `json:"origins"`
+		}{e.File, cfg, e.Origins})
+	case "yaml", "":
+		var doc yaml.Node
+		if err := doc.Encode(cfg); err != nil {
+			return err
+		}
+		annotate(&doc, "", e.Origins)
+		if e.File != "" {
+			fmt.Fprintf(w, "# config file: %s\n", e.File)
+		}
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(&doc); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("config: unknown format %q", format)
+	}
+}
+
+// annotate adds "# origin" comments to values that did not come from the
+// defaults.
+func annotate(node *yaml.Node, prefix string, origins map[string]string) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		path := strings.TrimPrefix(prefix+"."+key.Value, ".")
+		if value.Kind == yaml.MappingNode {
+			annotate(value, path, origins)
+			continue
+		}
+		if origin, ok := origins[path]; ok && origin != "default" {
+			value.LineComment = origin
+		}
+	}
+}
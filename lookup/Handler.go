@@ -13,7 +13,14 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp := Analyze(msisdn)
+	region := r.URL.Query().Get("region")
+	if region != "" && !Default().HasRegion(region) {
+		http.Error(w, "unknown region parameter", http.StatusBadRequest)
+		return
+	}
+
+	resp := AnalyzeWith(msisdn, Options{Region: region})
+	RecordHistory(resp)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
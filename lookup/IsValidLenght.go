@@ -1,13 +1,17 @@
 package lookup
 
 func IsValidLength(msisdn string) bool {
+	return Default().IsValidLength(msisdn)
+}
+
+func (a *Analyzer) IsValidLength(msisdn string) bool {
 	normalized := normalize(msisdn)
 	if normalized == "" {
 		return false
 	}
 
-	if country, _ := findCountryRule(normalized); country != nil {
-		return withinLength(normalized, country)
+	if country, _ := a.currentRules().findCountryRule(normalized); country != nil {
+		return withinLength(normalized, country.CountryRule)
 	}
 
 	return false
@@ -1,6 +1,7 @@
 package lookup
 
 import (
+	"fmt"
 	"strings"
 	"unicode"
 )
@@ -8,6 +9,11 @@ import (
 type normalizedPayload struct {
 	digits     string
 	digitsOnly bool
+	// raw holds the digits before a leading 00 was stripped and plus
+	// records whether the input started with "+"; both are needed to
+	// reinterpret national input against a default region.
+	raw  string
+	plus bool
 }
 
 func normalize(msisdn string) string {
@@ -19,6 +25,7 @@ func normalizeDetailed(msisdn string) normalizedPayload {
 	var builder strings.Builder
 	builder.Grow(len(trimmed))
 	digitsOnly := true
+	plus := false
 
 	for _, r := range trimmed {
 		switch {
@@ -26,6 +33,7 @@ func normalizeDetailed(msisdn string) normalizedPayload {
 			builder.WriteRune(r)
 		case r == '+' && builder.Len() == 0:
 			// skip leading plus
+			plus = true
 		case unicode.IsSpace(r):
 			// ignore whitespace completely
 		case r == '-' || r == '(' || r == ')' || r == '.':
@@ -35,10 +43,42 @@ func normalizeDetailed(msisdn string) normalizedPayload {
 		}
 	}
 
-	digits := builder.String()
+	raw := builder.String()
+	digits := raw
 	if strings.HasPrefix(digits, "00") {
 		digits = digits[2:]
 	}
 
-	return normalizedPayload{digits: digits, digitsOnly: digitsOnly}
+	return normalizedPayload{digits: digits, digitsOnly: digitsOnly, raw: raw, plus: plus}
+}
+
+// applyRegion reinterprets input written without a leading "+" using the
+// dialling conventions of region: its international call prefix marks a
+// foreign number, otherwise the trunk prefix (if any) is dropped and the
+// country code is prepended. The explanation describes the reconstruction.
+func (c *compiledRules) applyRegion(norm normalizedPayload, region string) (normalizedPayload, string) {
+	country, ok := c.countryByRegion[strings.ToUpper(region)]
+	if !ok {
+		return norm, fmt.Sprintf("Input: region %s not in rules, read as international number", region)
+	}
+	if norm.plus {
+		return norm, fmt.Sprintf("Input: leading + so region %s was not applied", country.regionLabel(region))
+	}
+	if norm.raw == "" {
+		return norm, ""
+	}
+
+	label := country.regionLabel(region)
+	code := country.dialCode
+	switch {
+	case country.InternationalPrefix != "" && strings.HasPrefix(norm.raw, country.InternationalPrefix):
+		norm.digits = norm.raw[len(country.InternationalPrefix):]
+		return norm, fmt.Sprintf("Input: international call prefix %s of %s stripped", country.InternationalPrefix, label)
+	case country.TrunkPrefix != "" && strings.HasPrefix(norm.raw, country.TrunkPrefix):
+		norm.digits = code + norm.raw[len(country.TrunkPrefix):]
+		return norm, fmt.Sprintf("Input: national number in %s, trunk prefix %s dropped and country code +%s added", label, country.TrunkPrefix, code)
+	default:
+		norm.digits = code + norm.raw
+		return norm, fmt.Sprintf("Input: national number in %s, country code +%s added", label, code)
+	}
 }
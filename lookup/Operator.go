@@ -2,12 +2,22 @@ package lookup
 
 // Operator returns the operator guess based on prefix rules.
 func Operator(msisdn string) string {
+	return Default().Operator(msisdn)
+}
+
+// Operator returns the operator guess based on prefix rules.
+func (a *Analyzer) Operator(msisdn string) string {
 	normalized := normalize(msisdn)
 	if normalized == "" {
 		return "Unknown"
 	}
 
-	if op, _ := resolveOperator(normalized); op != nil {
+	country, _ := a.currentRules().findCountryRule(normalized)
+	if country == nil {
+		return "Unknown"
+	}
+
+	if op, _, _ := country.matchOperator(normalized); op != nil {
 		return op.Name
 	}
 
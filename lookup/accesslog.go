@@ -0,0 +1,188 @@
+package lookup
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Masking modes for MaskPolicy.
+const (
+	MaskPartial = "partial"
+	MaskHash    = "hash"
+	MaskNone    = "none"
+)
+
+// MaskPolicy decides how MSISDNs appear in logs. Phone numbers are personal
+// data, so they are never written as received unless Mode is MaskNone.
+type MaskPolicy struct {
+	// Mode is MaskPartial (keep the country code and the last two digits,
+	// the default), MaskHash (a salted HMAC-SHA256, stable for one salt so
+	// repeated requests can be correlated) or MaskNone.
+	Mode string
+	// Salt keys the hash; required by MaskHash.
+	Salt string
+}
+
+// Validate reports an unknown mode or a hash policy without a salt.
+func (p MaskPolicy) Validate() error {
+	switch p.Mode {
+	case "", MaskPartial, MaskNone:
+		return nil
+	case MaskHash:
+		if p.Salt == "" {
+			return fmt.Errorf("lookup: mask policy %q needs a salt", p.Mode)
+		}
+		return nil
+	default:
+		return fmt.Errorf("lookup: unknown mask policy %q (want %s, %s or %s)", p.Mode, MaskPartial, MaskHash, MaskNone)
+	}
+}
+
+// Mask returns msisdn as it may be logged under the policy.
+func (p MaskPolicy) Mask(msisdn string) string {
+	if msisdn == "" || p.Mode == MaskNone {
+		return msisdn
+	}
+	digits := make([]byte, 0, len(msisdn))
+	for i := 0; i < len(msisdn); i++ {
+		if c := msisdn[i]; c >= '0' && c <= '9' {
+			digits = append(digits, c)
+		}
+	}
+
+	if p.Mode == MaskHash {
+		mac := hmac.New(sha256.New, []byte(p.Salt))
+		mac.Write(digits)
+		return "hmac:" + hex.EncodeToString(mac.Sum(nil))[:16]
+	}
+
+	keep := 0
+	if _, prefix := Default().currentRules().findCountryRule(string(digits)); prefix != "" && len(prefix) < len(digits)-2 {
+		keep = len(prefix)
+	}
+	tail := max(len(digits)-keep-2, 0)
+	masked := string(digits[:keep]) + strings.Repeat("*", tail) + string(digits[keep+tail:])
+	if keep > 0 {
+		masked = "+" + masked
+	}
+	return masked
+}
+
+type requestInfoKey struct{}
+
+// RequestID returns the ID AccessLog assigned to the request behind ctx.
+func RequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// requestInfo collects what handlers learn about a request for its access
+// log line.
+type requestInfo struct {
+	id     string
+	msisdn string
+	batch  int
+	apiKey string
+}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// noteMSISDN records the number a single lookup was made for.
+func noteMSISDN(ctx context.Context, msisdn string) {
+	if info := requestInfoFrom(ctx); info != nil {
+		info.msisdn = msisdn
+	}
+}
+
+// noteAPIKey records the name of the key or session a request was made with.
+func noteAPIKey(ctx context.Context, name string) {
+	if info := requestInfoFrom(ctx); info != nil {
+		info.apiKey = name
+	}
+}
+
+// noteBatch records the number of entries of a batch request.
+func noteBatch(ctx context.Context, entries int) {
+	if info := requestInfoFrom(ctx); info != nil {
+		info.batch = entries
+	}
+}
+
+// RequestIDHeader carries the request ID in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// AccessLog writes one log record per request served by h with the request
+// ID, route pattern, status, latency and, when known, the masked MSISDN or
+// the batch size. The path is logged without its query string, which may
+// hold a number. A valid X-Request-ID from the client is kept, otherwise one
+// is generated; either way it is echoed in the response. Like Instrument, h
+// must be a ServeMux or pass the request on to one.
+func AccessLog(logger *slog.Logger, policy MaskPolicy, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{id: r.Header.Get(RequestIDHeader), msisdn: r.URL.Query().Get("msisdn")}
+		if !validRequestID(info.id) {
+			info.id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, info.id)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		r = r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info))
+		h.ServeHTTP(rec, r)
+
+		attrs := []slog.Attr{
+			slog.String("requestId", info.id),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("endpoint", endpointOf(r)),
+			slog.Int("status", rec.code()),
+			slog.Float64("latencyMs", float64(time.Since(start).Microseconds())/1000),
+		}
+		if info.msisdn != "" {
+			attrs = append(attrs, slog.String("msisdn", policy.Mask(info.msisdn)))
+		}
+		if info.batch > 0 {
+			attrs = append(attrs, slog.Int("batchSize", info.batch))
+		}
+		if info.apiKey != "" {
+			attrs = append(attrs, slog.String("apiKey", info.apiKey))
+		}
+		level := slog.LevelInfo
+		if endpoint := endpointOf(r); endpoint == "/healthz" || endpoint == "/readyz" {
+			level = slog.LevelDebug // probes would drown everything else
+		}
+		logger.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if c <= ' ' || c >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
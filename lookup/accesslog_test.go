@@ -0,0 +1,102 @@
+package lookup
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaskPolicy(t *testing.T) {
+	partial := MaskPolicy{}
+	for in, want := range map[string]string{
+		"+381641234567":    "+381*******67",
+		"+39 338 326 0866": "+39********66",
+		"0641234567":       "********67",
+		"12":               "12",
+	} {
+		if got := partial.Mask(in); got != want {
+			t.Errorf("partial %q: got %q, want %q", in, got, want)
+		}
+	}
+
+	hash := MaskPolicy{Mode: MaskHash, Salt: "s1"}
+	a, b := hash.Mask("+381 64 1234567"), hash.Mask("+381641234567")
+	if a != b || !strings.HasPrefix(a, "hmac:") || strings.Contains(a, "1234567") {
+		t.Fatalf("hash should be stable across formatting and hide the number: %q %q", a, b)
+	}
+	if other := (MaskPolicy{Mode: MaskHash, Salt: "s2"}).Mask("+381641234567"); other == a {
+		t.Fatal("a different salt should give a different hash")
+	}
+
+	if err := (MaskPolicy{Mode: MaskHash}).Validate(); err == nil {
+		t.Fatal("hash without salt should be rejected")
+	}
+	if err := (MaskPolicy{Mode: "scramble"}).Validate(); err == nil {
+		t.Fatal("unknown modes should be rejected")
+	}
+}
+
+func TestAccessLogMasksNumbersAndEchoesRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	mux := http.NewServeMux()
+	NewAPI(nil).Register(mux)
+	h := AccessLog(slog.New(slog.NewJSONHandler(&logs, nil)), MaskPolicy{}, mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/lookup?msisdn=%2B381641234567", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get(RequestIDHeader); got != "abc-123" {
+		t.Fatalf("client request ID should be echoed, got %q", got)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/batch", strings.NewReader(`{"msisdns": ["+381641234567", "+41791234567"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	generated := rec.Header().Get(RequestIDHeader)
+	if len(generated) != 16 {
+		t.Fatalf("expected a generated request ID, got %q", generated)
+	}
+
+	if strings.Contains(logs.String(), "641234567") || strings.Contains(logs.String(), "791234567") {
+		t.Fatalf("numbers must not be logged unmasked:\n%s", logs.String())
+	}
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line is not JSON: %q", line)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected one record per request, got %d", len(records))
+	}
+	lookup, batch := records[0], records[1]
+	if lookup["requestId"] != "abc-123" || lookup["endpoint"] != "/v1/lookup" || lookup["status"] != 200.0 ||
+		lookup["msisdn"] != "+381*******67" || lookup["path"] != "/v1/lookup" {
+		t.Fatalf("unexpected lookup record: %v", lookup)
+	}
+	if _, ok := lookup["latencyMs"]; !ok {
+		t.Fatal("latency should be logged")
+	}
+	if batch["requestId"] != generated || batch["batchSize"] != 2.0 || batch["msisdn"] != nil {
+		t.Fatalf("unexpected batch record: %v", batch)
+	}
+}
+
+func TestAccessLogReplacesInvalidRequestID(t *testing.T) {
+	h := AccessLog(slog.New(slog.DiscardHandler), MaskPolicy{}, http.NewServeMux())
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get(RequestIDHeader); got == "bad id\n" || got == "" {
+		t.Fatalf("invalid request IDs should be replaced, got %q", got)
+	}
+}
@@ -2,6 +2,7 @@ package lookup
 
 import (
 	"fmt"
+	"math"
 	"strings"
 )
 
@@ -13,7 +14,42 @@ const (
 
 // Analyze performs full lookup with metadata/explanations.
 func Analyze(msisdn string) LookupResponse {
-	norm := normalizeDetailed(msisdn)
+	return Default().Analyze(msisdn)
+}
+
+// Options tune how input is interpreted before analysis.
+type Options struct {
+	// Region is an ISO 3166-1 alpha-2 code (e.g. "RS"). When set, input
+	// without a leading "+" is read as a national number of that region.
+	Region string
+}
+
+// AnalyzeWith performs a full lookup applying opts.
+func AnalyzeWith(msisdn string, opts Options) LookupResponse {
+	return Default().AnalyzeWith(msisdn, opts)
+}
+
+// Analyze performs full lookup with metadata/explanations.
+func (a *Analyzer) Analyze(msisdn string) LookupResponse {
+	return a.AnalyzeWith(msisdn, Options{})
+}
+
+// AnalyzeWith performs a full lookup applying opts.
+func (a *Analyzer) AnalyzeWith(msisdn string, opts Options) LookupResponse {
+	return a.currentRules().analyze(msisdn, opts)
+}
+
+// analyze resolves msisdn against this snapshot and counts the outcome in
+// the lookup metrics. The snapshot is never modified after it is built, so
+// any number of goroutines may share it.
+func (c *compiledRules) analyze(msisdn string, opts Options) LookupResponse {
+	resp := c.resolve(msisdn, opts)
+	recordLookup(&resp)
+	return resp
+}
+
+func (c *compiledRules) resolve(msisdn string, opts Options) LookupResponse {
+	norm, inputExplanation := c.prepare(msisdn, opts)
 	normalized := norm.digits
 	e164 := ""
 	if normalized != "" {
@@ -33,6 +69,7 @@ func Analyze(msisdn string) LookupResponse {
 		CountryConfidence:  confidenceHigh,
 		TypeConfidence:     confidenceMedium,
 		OperatorConfidence: confidenceLow,
+		Explain:            Explain{Input: inputExplanation},
 	}
 
 	if normalized == "" {
@@ -42,43 +79,45 @@ func Analyze(msisdn string) LookupResponse {
 		return resp
 	}
 
-	if country, prefix := findCountryRule(normalized); country != nil {
+	if country, prefix := c.findCountryRule(normalized); country != nil {
 		resp.Country = country.Name
 		resp.Valid.KnownCountryCode = true
-		resp.Valid.LengthOk = withinLength(normalized, country)
+		resp.Valid.LengthOk = withinLength(normalized, country.CountryRule)
 		resp.Explain.Country = fmt.Sprintf("Country: +%s -> %s (country code %s)", prefix, country.Name, prefix)
 
 		local := normalized[len(prefix):]
-		resp.NumberType, resp.Explain.Type = resolveType(local, country)
+		resp.NumberType, resp.Explain.Type = country.resolveType(normalized, local)
+
+		if op, explanation := country.resolveOperator(normalized); op != nil {
+			resp.Operator = op.Name
+			resp.MCC = op.MCC
+			resp.MNC = op.MNC
+			resp.Explain.Operator = explanation
+		} else {
+			resp.Explain.Operator = fmt.Sprintf("Operator guess: no matching prefix rule for %s", country.Name)
+		}
 	} else {
 		resp.Explain.Country = "Country: prefix not in rules"
 		resp.Explain.Type = "Type: country unknown so range can't be interpreted"
-	}
-
-	if op, explanation := resolveOperator(normalized); op != nil {
-		resp.Operator = op.Name
-		resp.MCC = op.MCC
-		resp.MNC = op.MNC
-		resp.Explain.Operator = explanation
-	} else {
-		resp.Explain.Operator = "Operator guess: no matching prefix rule"
+		resp.Explain.Operator = "Operator guess: country unknown so no operator rules apply"
 	}
 
 	return resp
 }
 
-func findCountryRule(msisdn string) (*CountryRule, string) {
-	if maxCountryPrefixLen == 0 {
-		return nil, ""
+// prepare normalizes msisdn and, when opts name a region, rewrites national
+// input to international form.
+func (c *compiledRules) prepare(msisdn string, opts Options) (normalizedPayload, string) {
+	norm := normalizeDetailed(msisdn)
+	if opts.Region == "" {
+		return norm, ""
 	}
-	for l := maxCountryPrefixLen; l >= 1; l-- {
-		if len(msisdn) < l {
-			continue
-		}
-		prefix := msisdn[:l]
-		if rule, ok := countryByPrefix[prefix]; ok {
-			return rule, prefix
-		}
+	return c.applyRegion(norm, opts.Region)
+}
+
+func (c *compiledRules) findCountryRule(msisdn string) (*countryIndex, string) {
+	if country, depth, ok := c.countryTrie.longest(msisdn); ok {
+		return country, msisdn[:depth]
 	}
 	return nil, ""
 }
@@ -94,7 +133,36 @@ func withinLength(msisdn string, country *CountryRule) bool {
 	return true
 }
 
-func resolveType(local string, country *CountryRule) (string, string) {
+// resolveType picks the most specific matching type block, then the first
+// matching prefix rule, then the fallback rule.
+func (c *countryIndex) resolveType(msisdn, local string) (string, string) {
+	var best *typeRange
+	bestCoverage := math.Inf(1)
+	for i, node := 0, int32(0); i < len(msisdn); i++ {
+		if node = c.typeRanges.child(node, msisdn[i]); node == 0 {
+			break
+		}
+		blocks := c.typeRanges.valueAt(node)
+		if blocks == nil {
+			continue
+		}
+		for j := range *blocks {
+			block := &(*blocks)[j]
+			if !block.contains(msisdn) {
+				continue
+			}
+			if coverage := block.coverage(len(msisdn)); coverage < bestCoverage {
+				best, bestCoverage = block, coverage
+			}
+		}
+	}
+	if best != nil {
+		return best.rule.Type, fmt.Sprintf("Type: block %s -> %s", best.label, best.rule.Explanation)
+	}
+	return resolvePrefixType(local, c.CountryRule)
+}
+
+func resolvePrefixType(local string, country *CountryRule) (string, string) {
 	for _, rule := range country.TypeRules {
 		if rule.Prefix == "" {
 			continue
@@ -105,7 +173,7 @@ func resolveType(local string, country *CountryRule) (string, string) {
 	}
 
 	for _, rule := range country.TypeRules {
-		if rule.Prefix == "" {
+		if rule.Prefix == "" && !rule.isRange() {
 			if rule.Explanation != "" {
 				return rule.Type, fmt.Sprintf("Type fallback: %s", rule.Explanation)
 			}
@@ -116,22 +184,61 @@ func resolveType(local string, country *CountryRule) (string, string) {
 	return "unknown", "Type: no matching rules"
 }
 
-func resolveOperator(msisdn string) (*operatorMetadata, string) {
-	if maxOperatorPrefixLen == 0 {
+// resolveOperator returns the most specific operator rule for msisdn together
+// with a human readable explanation.
+func (c *countryIndex) resolveOperator(msisdn string) (*operatorMetadata, string) {
+	op, prefixLen, block := c.matchOperator(msisdn)
+	switch {
+	case op == nil:
 		return nil, ""
+	case block != nil:
+		explanation := op.Explanation
+		if explanation == "" {
+			explanation = fmt.Sprintf("matches %s", op.Name)
+		}
+		return op, fmt.Sprintf("Operator guess: block %s -> %s", block.label, explanation)
+	default:
+		explanation := op.Explanation
+		if explanation == "" {
+			explanation = fmt.Sprintf("Prefix %s matches %s", msisdn[:prefixLen], op.Name)
+		}
+		return op, fmt.Sprintf("Operator guess: %s", explanation)
 	}
-	for l := maxOperatorPrefixLen; l >= 1; l-- {
-		if len(msisdn) < l {
+}
+
+// matchOperator finds the most specific operator rule for msisdn: the longest
+// matching prefix, unless a range block covers fewer numbers. Both kinds are
+// collected in a single walk down the operator trie without allocating. It
+// returns the matched prefix length, or the block when a range won.
+func (c *countryIndex) matchOperator(msisdn string) (*operatorMetadata, int, *operatorRange) {
+	var (
+		best         *operatorMetadata
+		bestPrefix   int
+		bestRange    *operatorRange
+		bestCoverage = math.Inf(1)
+	)
+
+	for i, node := 0, int32(0); i < len(msisdn); i++ {
+		if node = c.operators.child(node, msisdn[i]); node == 0 {
+			break
+		}
+		entry := c.operators.valueAt(node)
+		if entry == nil {
 			continue
 		}
-		prefix := msisdn[:l]
-		if op, ok := operatorByPrefix[prefix]; ok {
-			explanation := op.Explanation
-			if explanation == "" {
-				explanation = fmt.Sprintf("Prefix %s matches %s", prefix, op.Name)
+		if coverage := prefixCoverage(i+1, len(msisdn)); entry.prefix != nil && coverage < bestCoverage {
+			best, bestPrefix, bestRange, bestCoverage = entry.prefix, i+1, nil, coverage
+		}
+		for j := range entry.ranges {
+			block := &entry.ranges[j]
+			if !block.contains(msisdn) {
+				continue
+			}
+			if coverage := block.coverage(len(msisdn)); coverage < bestCoverage || (coverage == bestCoverage && bestRange == nil) {
+				best, bestRange, bestCoverage = block.op, block, coverage
 			}
-			return op, fmt.Sprintf("Operator guess: %s", explanation)
 		}
 	}
-	return nil, ""
+
+	return best, bestPrefix, bestRange
 }
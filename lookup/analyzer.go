@@ -0,0 +1,113 @@
+package lookup
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Analyzer resolves MSISDNs against a single rule set. It is safe for
+// concurrent use; reloading swaps the rules atomically so in-flight lookups
+// finish against the snapshot they started with.
+type Analyzer struct {
+	rules atomic.Pointer[compiledRules]
+
+	// source is where Reload fetches the rules from; nil when they came
+	// from a reader or an in-memory RuleSet and cannot be reloaded.
+	source *Source
+
+	mu      sync.Mutex // serialises reloads
+	lastErr error
+}
+
+// NewAnalyzer builds an Analyzer from JSON encoded rules.
+func NewAnalyzer(r io.Reader) (*Analyzer, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("lookup: unable to read rules: %w", err)
+	}
+	rules, err := compileRules(data)
+	if err != nil {
+		return nil, err
+	}
+	rules.status = RulesStatus{Source: "reader", Checksum: checksum(data), LoadedAt: time.Now().UTC()}
+	return newAnalyzer(rules, nil), nil
+}
+
+// LoadFile builds an Analyzer from a rules file. The file is remembered so the
+// analyzer can later be refreshed with Reload or Watch.
+func LoadFile(path string) (*Analyzer, error) {
+	return Open(Source{Path: path})
+}
+
+// FromRuleSet builds an Analyzer from rules assembled in memory. The set is
+// copied, so later changes by the caller do not leak into the analyzer.
+func FromRuleSet(set RuleSet) (*Analyzer, error) {
+	rules, err := compileRuleSet(set.clone())
+	if err != nil {
+		return nil, err
+	}
+	rules.status = RulesStatus{Source: "memory", LoadedAt: time.Now().UTC()}
+	return newAnalyzer(rules, nil), nil
+}
+
+func newAnalyzer(rules *compiledRules, source *Source) *Analyzer {
+	a := &Analyzer{source: source}
+	a.rules.Store(rules)
+	return a
+}
+
+// currentRules returns the rule snapshot in effect. Callers should fetch it
+// once per lookup so all steps of an analysis see the same rules.
+func (a *Analyzer) currentRules() *compiledRules {
+	return a.rules.Load()
+}
+
+// LastError reports why the most recent load or reload failed, or nil when
+// it succeeded.
+func (a *Analyzer) LastError() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.lastErr
+}
+
+var (
+	defaultOnce     sync.Once
+	defaultAnalyzer atomic.Pointer[Analyzer]
+)
+
+// Default returns the analyzer used by the package level functions. Unless
+// SetDefault was called it is built on first use from SourceFromEnv. If the
+// configured file cannot be loaded the embedded rules are served instead and
+// LastError reports the cause until a later Reload succeeds. Nothing is
+// printed: callers that want the load error or the rule warnings logged read
+// them from LastError and Warnings.
+func Default() *Analyzer {
+	defaultOnce.Do(func() {
+		if defaultAnalyzer.Load() != nil {
+			return
+		}
+		defaultAnalyzer.CompareAndSwap(nil, openOrEmbedded(SourceFromEnv()))
+	})
+	return defaultAnalyzer.Load()
+}
+
+// openOrEmbedded opens src, falling back to the embedded rules with the
+// error kept for LastError.
+func openOrEmbedded(src Source) *Analyzer {
+	a, err := Open(src)
+	if err != nil {
+		a = LoadEmbedded()
+		a.source = &src
+		a.lastErr = err
+	}
+	return a
+}
+
+// SetDefault makes a the analyzer behind the package level functions and
+// handlers.
+func SetDefault(a *Analyzer) {
+	defaultAnalyzer.Store(a)
+}
@@ -0,0 +1,216 @@
+package lookup
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const defaultMaxBatchBytes = 1 << 20
+
+// API serves the versioned JSON endpoints under /v1. Every response, errors
+// included, is JSON; failures use the ErrorResponse envelope.
+type API struct {
+	// Analyzer resolves the numbers; nil means Default().
+	Analyzer *Analyzer
+	// MaxBatchBytes caps the body of a batch request (default 1 MB).
+	MaxBatchBytes int64
+	// Pool analyses batch entries concurrently; nil means
+	// DefaultWorkerPool().
+	Pool *WorkerPool
+}
+
+// NewAPI returns an API backed by a with the limits set by SetBatchLimits.
+func NewAPI(a *Analyzer) *API {
+	return &API{Analyzer: a, MaxBatchBytes: currentBatchLimits().MaxBytes}
+}
+
+// Register mounts the /v1 routes on mux.
+func (api *API) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/lookup", api.Lookup)
+	mux.HandleFunc("/v1/batch", api.Batch)
+	mux.HandleFunc("/v1/batch/stream", api.BatchStream)
+	mux.HandleFunc("/v1/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "not_found", "no such endpoint", "")
+	})
+}
+
+// LookupRequest is the body accepted by POST /v1/lookup.
+type LookupRequest struct {
+	MSISDN string `json:"msisdn"`
+	Region string `json:"region,omitempty"`
+}
+
+// BatchRequest is the JSON body accepted by POST /v1/batch.
+type BatchRequest struct {
+	MSISDNs []string `json:"msisdns"`
+	Region  string   `json:"region,omitempty"`
+	// Dedupe analyses each normalized number only once.
+	Dedupe bool `json:"dedupe,omitempty"`
+}
+
+// BatchResponse is returned by POST /v1/batch.
+type BatchResponse struct {
+	Count   int              `json:"count"`
+	Results []LookupResponse `json:"results"`
+	Summary BatchSummary     `json:"summary"`
+}
+
+// ErrorResponse is the envelope of every /v1 error.
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// APIError describes what went wrong. Code is stable and meant for machines;
+// Field names the offending parameter when there is one and Line the input
+// line of a streamed batch.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+	Line    int    `json:"line,omitempty"`
+}
+
+func (api *API) analyzer() *Analyzer {
+	if api.Analyzer != nil {
+		return api.Analyzer
+	}
+	return Default()
+}
+
+func (api *API) pool() *WorkerPool {
+	if api.Pool != nil {
+		return api.Pool
+	}
+	return DefaultWorkerPool()
+}
+
+func (api *API) maxBatchBytes() int64 {
+	if api.MaxBatchBytes > 0 {
+		return api.MaxBatchBytes
+	}
+	return defaultMaxBatchBytes
+}
+
+// Lookup handles GET /v1/lookup?msisdn=...&region=... and POST /v1/lookup
+// with a LookupRequest body.
+func (api *API) Lookup(w http.ResponseWriter, r *http.Request) {
+	var req LookupRequest
+	switch r.Method {
+	case http.MethodGet:
+		req.MSISDN = r.URL.Query().Get("msisdn")
+		req.Region = r.URL.Query().Get("region")
+	case http.MethodPost:
+		if !api.decodeJSON(w, r, 64<<10, &req) {
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "lookup expects GET or POST", "")
+		return
+	}
+
+	noteMSISDN(r.Context(), req.MSISDN)
+	if strings.TrimSpace(req.MSISDN) == "" {
+		writeAPIError(w, http.StatusBadRequest, "missing_parameter", "msisdn is required", "msisdn")
+		return
+	}
+	if !api.checkRegion(w, req.Region) {
+		return
+	}
+
+	resp := api.analyzer().AnalyzeWith(req.MSISDN, Options{Region: req.Region})
+	RecordHistory(resp)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Batch handles POST /v1/batch with either a BatchRequest JSON body or a
+// text/plain body of newline separated numbers (region and dedupe then come
+// from the query string).
+func (api *API) Batch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "batch expects POST", "")
+		return
+	}
+
+	req := BatchRequest{Region: r.URL.Query().Get("region")}
+	req.Dedupe, _ = strconv.ParseBool(r.URL.Query().Get("dedupe"))
+	if isJSONRequest(r) {
+		if !api.decodeJSON(w, r, api.maxBatchBytes(), &req) {
+			return
+		}
+	} else {
+		raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, api.maxBatchBytes()))
+		if err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		req.MSISDNs = strings.Split(string(raw), "\n")
+	}
+
+	entries := numberedBatchList(req.MSISDNs)
+	if len(entries) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "empty_batch", "batch contains no numbers", "msisdns")
+		return
+	}
+	if !api.checkRegion(w, req.Region) {
+		return
+	}
+
+	run, err := runBatch(r.Context(), api.pool(), api.analyzer(), entries, Options{Region: req.Region}, req.Dedupe)
+	if err != nil {
+		return // client went away
+	}
+	writeJSON(w, http.StatusOK, BatchResponse{Count: len(run.results), Results: run.results, Summary: run.summary})
+}
+
+func (api *API) checkRegion(w http.ResponseWriter, region string) bool {
+	if region != "" && !api.analyzer().HasRegion(region) {
+		writeAPIError(w, http.StatusBadRequest, "unknown_region", "region is not defined in the rules", "region")
+		return false
+	}
+	return true
+}
+
+func (api *API) decodeJSON(w http.ResponseWriter, r *http.Request, limit int64, dst any) bool {
+	if !isJSONRequest(r) {
+		writeAPIError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "body must be application/json", "")
+		return false
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		writeBodyError(w, err)
+		return false
+	}
+	return true
+}
+
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+func writeBodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, "payload_too_large", "request body is too large", "")
+		return
+	}
+	writeAPIError(w, http.StatusBadRequest, "invalid_body", "unable to decode request body: "+err.Error(), "")
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message, field string) {
+	writeJSON(w, status, ErrorResponse{Error: APIError{Code: code, Message: message, Field: field}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(payload)
+}
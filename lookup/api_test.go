@@ -0,0 +1,237 @@
+package lookup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serveAPI(t *testing.T, api *API, method, target, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := http.NewServeMux()
+	api.Register(mux)
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("%s %s: expected JSON response, got %q", method, target, ct)
+	}
+	return rec
+}
+
+func TestAPILookupAcceptsQueryAndJSONBody(t *testing.T) {
+	api := NewAPI(nil)
+
+	for _, rec := range []*httptest.ResponseRecorder{
+		serveAPI(t, api, http.MethodGet, "/v1/lookup?msisdn=0641234567&region=RS", "", ""),
+		serveAPI(t, api, http.MethodPost, "/v1/lookup", "application/json", `{"msisdn": "0641234567", "region": "RS"}`),
+	} {
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body)
+		}
+		var resp LookupResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.E164 != "+381641234567" || resp.Country != "Serbia" {
+			t.Fatalf("unexpected lookup payload: %+v", resp)
+		}
+	}
+}
+
+func TestAPIBatchReturnsResultsWithoutHTML(t *testing.T) {
+	rec := serveAPI(t, NewAPI(nil), http.MethodPost, "/v1/batch", "application/json",
+		`{"msisdns": ["+393383260866", " ", "+41791234567"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), "<table") {
+		t.Fatalf("v1 batch must not embed HTML: %s", rec.Body)
+	}
+	var resp BatchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Count != 2 || resp.Results[1].Operator != "Swisscom Mobile (079 prefix)" {
+		t.Fatalf("unexpected batch payload: %+v", resp)
+	}
+}
+
+func TestAPIErrorsUseJSONEnvelope(t *testing.T) {
+	api := &API{MaxBatchBytes: 16}
+	cases := []struct {
+		method, target, contentType, body string
+		status                            int
+		code, field                       string
+	}{
+		{http.MethodGet, "/v1/lookup", "", "", http.StatusBadRequest, "missing_parameter", "msisdn"},
+		{http.MethodGet, "/v1/lookup?msisdn=064&region=ZZ", "", "", http.StatusBadRequest, "unknown_region", "region"},
+		{http.MethodPost, "/v1/lookup", "application/json", `{"msisdn": 5}`, http.StatusBadRequest, "invalid_body", ""},
+		{http.MethodPost, "/v1/lookup", "text/plain", "+38164", http.StatusUnsupportedMediaType, "unsupported_media_type", ""},
+		{http.MethodDelete, "/v1/lookup", "", "", http.StatusMethodNotAllowed, "method_not_allowed", ""},
+		{http.MethodGet, "/v1/batch", "", "", http.StatusMethodNotAllowed, "method_not_allowed", ""},
+		{http.MethodPost, "/v1/batch", "text/plain", "\n \n", http.StatusBadRequest, "empty_batch", "msisdns"},
+		{http.MethodPost, "/v1/batch", "text/plain", strings.Repeat("+38164123456\n", 4), http.StatusRequestEntityTooLarge, "payload_too_large", ""},
+		{http.MethodGet, "/v1/nope", "", "", http.StatusNotFound, "not_found", ""},
+	}
+
+	for _, tc := range cases {
+		rec := serveAPI(t, api, tc.method, tc.target, tc.contentType, tc.body)
+		var resp ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s %s: body is not an error envelope: %s", tc.method, tc.target, rec.Body)
+		}
+		if rec.Code != tc.status || resp.Error.Code != tc.code || resp.Error.Field != tc.field || resp.Error.Message == "" {
+			t.Fatalf("%s %s: got %d %+v, want %d %s/%s", tc.method, tc.target, rec.Code, resp.Error, tc.status, tc.code, tc.field)
+		}
+	}
+}
+
+func TestAPIBatchStreamWritesOneLinePerInput(t *testing.T) {
+	mux := http.NewServeMux()
+	NewAPI(nil).Register(mux)
+
+	body := strings.Join([]string{
+		"0641234567",
+		"",
+		`{"msisdn": "+41791234567"}`,
+		`"+393383260866"`,
+		`{"msisdn": "064", "region": "ZZ"}`,
+		`{"msisdn": `,
+		strings.Repeat("9", maxStreamLine+1),
+	}, "\n")
+	req := httptest.NewRequest(http.MethodPost, "/v1/batch/stream?region=RS", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("unexpected response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("expected 6 output lines, got %d:\n%s", len(lines), rec.Body)
+	}
+
+	for i, want := range []string{"+381641234567", "+41791234567", "+393383260866"} {
+		var resp LookupResponse
+		if err := json.Unmarshal([]byte(lines[i]), &resp); err != nil || resp.E164 != want {
+			t.Fatalf("line %d: expected %s, got %s", i+1, want, lines[i])
+		}
+	}
+	for i, want := range []struct {
+		code string
+		line int
+	}{{"unknown_region", 5}, {"invalid_line", 6}, {"invalid_line", 7}} {
+		var resp ErrorResponse
+		if err := json.Unmarshal([]byte(lines[3+i]), &resp); err != nil || resp.Error.Code != want.code || resp.Error.Line != want.line {
+			t.Fatalf("expected %s error for input line %d, got %s", want.code, want.line, lines[3+i])
+		}
+	}
+}
+
+func TestAPIBatchStreamOutlivesServerTimeouts(t *testing.T) {
+	mux := http.NewServeMux()
+	NewAPI(nil).Register(mux)
+	srv := httptest.NewUnstartedServer(mux)
+	srv.Config.ReadTimeout = 200 * time.Millisecond
+	srv.Config.WriteTimeout = 200 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	body, send := io.Pipe()
+	go func() {
+		for i := 0; i < 4; i++ {
+			io.WriteString(send, strings.Repeat("+381641234567\n", streamFlushEvery))
+			time.Sleep(100 * time.Millisecond)
+		}
+		send.Close()
+	}()
+	resp, err := http.Post(srv.URL+"/v1/batch/stream", "text/plain", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if lines := strings.Count(string(out), "\n"); err != nil || lines != 4*streamFlushEvery {
+		t.Fatalf("expected %d results from a stream longer than the timeouts, got %d: %v", 4*streamFlushEvery, lines, err)
+	}
+}
+
+func TestStreamBatchStopsWhenContextIsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &cancelAfterWrites{cancel: cancel, limit: 1}
+
+	in := strings.NewReader(strings.Repeat("+381641234567\n", 10*streamFlushEvery))
+	written, err := LoadEmbedded().StreamBatch(ctx, in, out, Options{}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if written >= 10*streamFlushEvery {
+		t.Fatalf("expected the stream to stop early, wrote %d results", written)
+	}
+}
+
+// cancelAfterWrites cancels the context once limit writes went through,
+// standing in for a client that disconnects mid-stream.
+type cancelAfterWrites struct {
+	cancel func()
+	limit  int
+	writes int
+}
+
+func (w *cancelAfterWrites) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes >= w.limit {
+		w.cancel()
+	}
+	return len(p), nil
+}
+
+func TestAPIBatchSummarisesAndDedupes(t *testing.T) {
+	body := `{"msisdns": ["+381641234567", "", "064 123 4567", "12", "+41791234567", "00381641234567"], "region": "RS"}`
+
+	rec := serveAPI(t, NewAPI(nil), http.MethodPost, "/v1/batch", "application/json", body)
+	var resp BatchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	summary := resp.Summary
+	if summary.Entries != 5 || summary.Analyzed != 5 || resp.Count != 5 {
+		t.Fatalf("unexpected counts %+v", summary)
+	}
+	if summary.Countries["Serbia"] != 4 || summary.Countries["Switzerland"] != 1 || summary.NumberTypes["mobile"] != 4 || summary.Networks["220/03"] != 3 {
+		t.Fatalf("unexpected breakdown %+v", summary)
+	}
+	if summary.Valid != 4 || summary.Invalid.Total != 1 || summary.Invalid.LengthOk != 1 || summary.Invalid.KnownCountryCode != 0 {
+		t.Fatalf("unexpected validity counts %+v", summary)
+	}
+	if len(summary.Duplicates) != 1 {
+		t.Fatalf("expected one duplicate, got %+v", summary.Duplicates)
+	}
+	dup := summary.Duplicates[0]
+	if dup.E164 != "+381641234567" || fmt.Sprint(dup.Lines) != "[1 3 6]" || dup.Inputs[1] != "064 123 4567" {
+		t.Fatalf("unexpected duplicate %+v", dup)
+	}
+
+	rec = serveAPI(t, NewAPI(nil), http.MethodPost, "/v1/batch", "application/json", strings.Replace(body, `"region"`, `"dedupe": true, "region"`, 1))
+	resp = BatchResponse{}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.Count != 3 || resp.Summary.Entries != 5 || resp.Summary.Analyzed != 3 || len(resp.Summary.Duplicates) != 1 {
+		t.Fatalf("dedupe should analyse each number once, got %d results and %+v", resp.Count, resp.Summary)
+	}
+	if resp.Results[0].Input != "+381641234567" || resp.Results[1].Input != "12" {
+		t.Fatalf("dedupe should keep first occurrences in order, got %+v", resp.Results)
+	}
+}
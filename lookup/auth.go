@@ -0,0 +1,330 @@
+package lookup
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKey is one client allowed to call the protected routes. Zero limits
+// fall back to the AuthConfig defaults.
+type APIKey struct {
+	Name          string `json:"name"`
+	Key           string `json:"key"`
+	RatePerMinute int    `json:"ratePerMinute,omitempty"`
+	Burst         int    `json:"burst,omitempty"`
+	DailyQuota    int    `json:"dailyQuota,omitempty"`
+}
+
+// LoadAPIKeys reads a keys file of the form
+//
+//	{"keys": [{"name": "crm", "key": "…", "ratePerMinute": 600, "dailyQuota": 50000}]}
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("lookup: unable to read API keys: %w", err)
+	}
+	var file struct {
+		Keys []APIKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("lookup: unable to parse API keys %s: %w", path, err)
+	}
+	return file.Keys, nil
+}
+
+// ParseAPIKeys reads keys written as "name:key,name:key", the format of the
+// LOOKUP_API_KEYS environment variable.
+func ParseAPIKeys(s string) ([]APIKey, error) {
+	var keys []APIKey
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, errors.New("lookup: API keys must be written as name:key") // never echo the key
+		}
+		keys = append(keys, APIKey{Name: name, Key: key})
+	}
+	return keys, nil
+}
+
+// AuthConfig configures NewAuth. Zero limits select the defaults: 600
+// requests per minute with bursts of 60 and no daily quota.
+type AuthConfig struct {
+	Keys          []APIKey
+	RatePerMinute int
+	Burst         int
+	DailyQuota    int
+	// SessionTTL is how long a browser session issued by the web UI stays
+	// valid (default 12h).
+	SessionTTL time.Duration
+}
+
+// Auth requires an API key on every route but a short list of public ones
+// and rate limits each key with a token bucket and a daily quota. Browsers
+// that loaded the web UI get a signed session cookie instead. Every session
+// shares one limiter, so fetching a new cookie never buys a fresh budget.
+type Auth struct {
+	keys     map[string]*keyLimiter // by sha256 of the key
+	sessions *keyLimiter
+	cfg      AuthConfig
+	secret   []byte
+	now      func() time.Time
+}
+
+// publicRoutes stay reachable without a key: the UI shell, probes,
+// metrics and documentation. Everything else, including routes added
+// later, is protected.
+var publicRoutes = map[string]bool{
+	"/":             true,
+	"/static/":      true,
+	"/healthz":      true,
+	"/readyz":       true,
+	"/version":      true,
+	"/metrics":      true,
+	"/openapi.json": true,
+	"/rules/status": true,
+}
+
+// keyOnlyRoutes refuse UI sessions: administration and the lookup history,
+// which would otherwise be open to anyone who can load the page.
+var keyOnlyRoutes = map[string]bool{
+	"/admin/reload": true,
+	"/v1/history":   true,
+	"/history":      true,
+}
+
+const sessionCookie = "lookup_session"
+
+// NewAuth validates cfg and returns the authenticator. Keys need a name and
+// a value, and both must be unique.
+func NewAuth(cfg AuthConfig) (*Auth, error) {
+	if cfg.RatePerMinute <= 0 {
+		cfg.RatePerMinute = 600
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = 60
+	}
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = 12 * time.Hour
+	}
+	a := &Auth{
+		keys:   make(map[string]*keyLimiter, len(cfg.Keys)),
+		cfg:    cfg,
+		secret: make([]byte, 32),
+		now:    time.Now,
+	}
+	a.sessions = a.newLimiter(APIKey{Name: "ui-session"})
+	rand.Read(a.secret)
+
+	names := make(map[string]bool, len(cfg.Keys))
+	for _, key := range cfg.Keys {
+		if key.Name == "" || key.Key == "" {
+			return nil, fmt.Errorf("lookup: API key %q needs a name and a key", key.Name)
+		}
+		hash := hashKey(key.Key)
+		if names[key.Name] || a.keys[hash] != nil {
+			return nil, fmt.Errorf("lookup: API key %q is defined twice", key.Name)
+		}
+		names[key.Name] = true
+		a.keys[hash] = a.newLimiter(key)
+	}
+	return a, nil
+}
+
+func (a *Auth) newLimiter(key APIKey) *keyLimiter {
+	if key.RatePerMinute <= 0 {
+		key.RatePerMinute = a.cfg.RatePerMinute
+	}
+	if key.Burst <= 0 {
+		key.Burst = a.cfg.Burst
+	}
+	if key.DailyQuota <= 0 {
+		key.DailyQuota = a.cfg.DailyQuota
+	}
+	return &keyLimiter{
+		name:   key.Name,
+		rate:   float64(key.RatePerMinute) / 60,
+		burst:  float64(key.Burst),
+		quota:  key.DailyQuota,
+		tokens: float64(key.Burst),
+	}
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Wrap enforces authentication and limits in front of mux. The web UI page
+// hands out a session cookie so the browser can call the protected routes.
+func (a *Auth) Wrap(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		route := pattern
+		if i := strings.IndexByte(route, ' '); i >= 0 {
+			route = route[i+1:]
+		}
+		if pattern == "" || publicRoutes[route] {
+			if route == "/" && r.URL.Path == "/" && r.Method == http.MethodGet {
+				a.ensureSession(w, r)
+			}
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		limiter, reason := a.authenticate(r)
+		if limiter == a.sessions && keyOnlyRoutes[route] {
+			limiter, reason = nil, "session_not_allowed"
+		}
+		if limiter == nil {
+			r.Pattern = pattern // so access logs and metrics name the route
+			authRejected.WithLabelValues(reason).Inc()
+			w.Header().Set("WWW-Authenticate", `Bearer realm="msisdn-lookup"`)
+			writeAPIError(w, http.StatusUnauthorized, "unauthorized", "a valid API key is required (Authorization: Bearer <key> or X-API-Key)", "")
+			return
+		}
+		noteAPIKey(r.Context(), limiter.name)
+		if retry, reason := limiter.take(a.now()); retry > 0 {
+			r.Pattern = pattern
+			authRejected.WithLabelValues(reason).Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+			if reason == "quota" {
+				writeAPIError(w, http.StatusTooManyRequests, "quota_exceeded", "daily quota exhausted, it resets at midnight UTC", "")
+			} else {
+				writeAPIError(w, http.StatusTooManyRequests, "rate_limited", "too many requests, slow down", "")
+			}
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// authenticate returns the limiter of the key or session behind r, or the
+// reason there is none.
+func (a *Auth) authenticate(r *http.Request) (*keyLimiter, string) {
+	key := r.Header.Get("X-API-Key")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		key = strings.TrimSpace(bearer)
+	}
+	if key != "" {
+		if limiter := a.keys[hashKey(key)]; limiter != nil {
+			return limiter, ""
+		}
+		return nil, "invalid_key"
+	}
+
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, "missing_key"
+	}
+	// A cross-site request must not ride on the user's session.
+	if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return nil, "cross_site"
+	}
+	if !a.verifySession(cookie.Value) {
+		return nil, "invalid_session"
+	}
+	return a.sessions, ""
+}
+
+// ensureSession sets a session cookie unless r already carries a valid one.
+func (a *Auth) ensureSession(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil && a.verifySession(cookie.Value) {
+		return
+	}
+
+	var payload [16]byte // 8 bytes expiry, 8 bytes random id
+	expires := a.now().Add(a.cfg.SessionTTL)
+	binary.BigEndian.PutUint64(payload[:8], uint64(expires.Unix()))
+	rand.Read(payload[8:])
+	value := base64.RawURLEncoding.EncodeToString(payload[:]) + "." + a.sign(payload[:])
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func (a *Auth) sign(payload []byte) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifySession checks the signature and expiry of a cookie value. Sessions
+// keep no server-side state.
+func (a *Auth) verifySession(value string) bool {
+	encoded, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(payload) != 16 || !hmac.Equal([]byte(signature), []byte(a.sign(payload))) {
+		return false
+	}
+	expires := time.Unix(int64(binary.BigEndian.Uint64(payload[:8])), 0)
+	return !a.now().After(expires)
+}
+
+// keyLimiter is the token bucket and daily quota of one key or of all UI
+// sessions together.
+type keyLimiter struct {
+	name  string
+	rate  float64 // tokens per second
+	burst float64
+	quota int // requests per UTC day, 0 for none
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	day    string
+	used   int
+}
+
+// take spends one request. When the request is over a limit it returns how
+// long to wait and which limit ("rate" or "quota") was hit.
+func (l *keyLimiter) take(now time.Time) (time.Duration, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now = now.UTC()
+	if day := now.Format(time.DateOnly); day != l.day {
+		l.day, l.used = day, 0
+	}
+	if l.quota > 0 && l.used >= l.quota {
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		return midnight.Sub(now), "quota"
+	}
+
+	if !l.last.IsZero() {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return time.Duration((1 - l.tokens) / l.rate * float64(time.Second)), "rate"
+	}
+	l.tokens--
+	l.used++
+	return 0, ""
+}
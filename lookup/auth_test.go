@@ -0,0 +1,179 @@
+package lookup
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func authMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ui")) })
+	mux.HandleFunc("/lookup", Handler)
+	mux.HandleFunc("/healthz", HealthzHandler)
+	mux.HandleFunc("/admin/reload", func(w http.ResponseWriter, r *http.Request) {})
+	return mux
+}
+
+func authRequest(h http.Handler, path string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthRequiresKeyOnProtectedRoutes(t *testing.T) {
+	auth, err := NewAuth(AuthConfig{Keys: []APIKey{{Name: "crm", Key: "s3cret"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := auth.Wrap(authMux())
+
+	for _, path := range []string{"/lookup?msisdn=%2B381641234567", "/admin/reload"} {
+		rec := authRequest(h, path)
+		if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+			t.Fatalf("%s without a key: %d", path, rec.Code)
+		}
+	}
+	if rec := authRequest(h, "/lookup?msisdn=1", "X-API-Key", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong key: %d", rec.Code)
+	}
+	if rec := authRequest(h, "/lookup?msisdn=%2B381641234567", "Authorization", "Bearer s3cret"); rec.Code != http.StatusOK {
+		t.Fatalf("bearer key: %d %s", rec.Code, rec.Body)
+	}
+	if rec := authRequest(h, "/lookup?msisdn=%2B381641234567", "X-API-Key", "s3cret"); rec.Code != http.StatusOK {
+		t.Fatalf("X-API-Key: %d %s", rec.Code, rec.Body)
+	}
+	if rec := authRequest(h, "/healthz"); rec.Code != http.StatusOK {
+		t.Fatalf("public routes need no key, got %d", rec.Code)
+	}
+}
+
+func TestAuthRateLimitAndDailyQuota(t *testing.T) {
+	now := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	auth, err := NewAuth(AuthConfig{Keys: []APIKey{
+		{Name: "burst", Key: "b", RatePerMinute: 1, Burst: 2},
+		{Name: "quota", Key: "q", DailyQuota: 1},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.now = func() time.Time { return now }
+	h := auth.Wrap(authMux())
+
+	for i := 0; i < 2; i++ {
+		if rec := authRequest(h, "/lookup?msisdn=1", "X-API-Key", "b"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d within the burst: %d", i, rec.Code)
+		}
+	}
+	rec := authRequest(h, "/lookup?msisdn=1", "X-API-Key", "b")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" || !strings.Contains(rec.Body.String(), "rate_limited") {
+		t.Fatalf("expected 429 after the burst, got %d Retry-After %q %s", rec.Code, rec.Header().Get("Retry-After"), rec.Body)
+	}
+	now = now.Add(time.Minute)
+	if rec := authRequest(h, "/lookup?msisdn=1", "X-API-Key", "b"); rec.Code != http.StatusOK {
+		t.Fatalf("the bucket should refill, got %d", rec.Code)
+	}
+
+	authRequest(h, "/lookup?msisdn=1", "X-API-Key", "q")
+	rec = authRequest(h, "/lookup?msisdn=1", "X-API-Key", "q")
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "quota_exceeded") || rec.Header().Get("Retry-After") != "3540" {
+		t.Fatalf("expected the quota to run out until midnight, got %d Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	now = now.Add(time.Hour)
+	if rec := authRequest(h, "/lookup?msisdn=1", "X-API-Key", "q"); rec.Code != http.StatusOK {
+		t.Fatalf("the quota should reset at midnight UTC, got %d", rec.Code)
+	}
+}
+
+func TestAuthSessionLetsTheWebUICallProtectedRoutes(t *testing.T) {
+	auth, err := NewAuth(AuthConfig{Keys: []APIKey{{Name: "crm", Key: "s3cret"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := auth.Wrap(authMux())
+
+	page := authRequest(h, "/")
+	cookies := page.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Fatalf("the UI page should set a session cookie, got %v", cookies)
+	}
+	session := cookies[0].Name + "=" + cookies[0].Value
+
+	if rec := authRequest(h, "/lookup?msisdn=%2B381641234567", "Cookie", session, "Sec-Fetch-Site", "same-origin"); rec.Code != http.StatusOK {
+		t.Fatalf("session request: %d %s", rec.Code, rec.Body)
+	}
+	if rec := authRequest(h, "/lookup?msisdn=1", "Cookie", session, "Sec-Fetch-Site", "cross-site"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("cross-site requests must not use the session, got %d", rec.Code)
+	}
+	if rec := authRequest(h, "/lookup?msisdn=1", "Cookie", session+"x"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("a tampered cookie must be refused, got %d", rec.Code)
+	}
+	if again := authRequest(h, "/", "Cookie", session); len(again.Result().Cookies()) != 0 {
+		t.Fatal("a valid session should not be replaced")
+	}
+
+	auth.now = func() time.Time { return time.Now().Add(13 * time.Hour) }
+	if rec := authRequest(h, "/lookup?msisdn=1", "Cookie", session); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("an expired session must be refused, got %d", rec.Code)
+	}
+}
+
+func TestAuthSessionsShareOneLimiterAndStayOffKeyOnlyRoutes(t *testing.T) {
+	auth, err := NewAuth(AuthConfig{Keys: []APIKey{{Name: "crm", Key: "s3cret"}}, RatePerMinute: 1, Burst: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := auth.Wrap(authMux())
+	newSession := func() string {
+		cookie := authRequest(h, "/").Result().Cookies()[0]
+		return cookie.Name + "=" + cookie.Value
+	}
+
+	first := newSession()
+	for i := 0; i < 2; i++ {
+		if rec := authRequest(h, "/lookup?msisdn=1", "Cookie", first); rec.Code != http.StatusOK {
+			t.Fatalf("request %d within the burst: %d", i, rec.Code)
+		}
+	}
+	if rec := authRequest(h, "/lookup?msisdn=1", "Cookie", newSession()); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("a second cookie must not get a fresh bucket, got %d", rec.Code)
+	}
+	if rec := authRequest(h, "/lookup?msisdn=1", "X-API-Key", "s3cret"); rec.Code != http.StatusOK {
+		t.Fatalf("keys keep their own bucket, got %d", rec.Code)
+	}
+
+	if rec := authRequest(h, "/admin/reload", "Cookie", newSession()); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("sessions must not reach key-only routes, got %d", rec.Code)
+	}
+	if rec := authRequest(h, "/admin/reload", "X-API-Key", "s3cret"); rec.Code != http.StatusOK {
+		t.Fatalf("key on a key-only route: %d", rec.Code)
+	}
+}
+
+func TestLoadAndParseAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	os.WriteFile(path, []byte(`{"keys": [{"name": "crm", "key": "a", "dailyQuota": 5}]}`), 0o600)
+	keys, err := LoadAPIKeys(path)
+	if err != nil || len(keys) != 1 || keys[0].DailyQuota != 5 {
+		t.Fatalf("unexpected keys %+v: %v", keys, err)
+	}
+
+	keys, err = ParseAPIKeys("crm:a, billing:b:c")
+	if err != nil || len(keys) != 2 || keys[1].Name != "billing" || keys[1].Key != "b:c" {
+		t.Fatalf("unexpected keys %+v: %v", keys, err)
+	}
+	if _, err := ParseAPIKeys("justakey"); err == nil {
+		t.Fatal("keys without a name should be rejected")
+	}
+	if _, err := NewAuth(AuthConfig{Keys: []APIKey{{Name: "a", Key: "x"}, {Name: "b", Key: "x"}}}); err == nil {
+		t.Fatal("duplicate keys should be rejected")
+	}
+}
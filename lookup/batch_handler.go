@@ -3,123 +3,98 @@ package lookup
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
-	"text/template"
 )
 
-type batchResponse struct {
+// BatchResult is the body of a /batch response: the results in input order
+// and their summary.
+type BatchResult struct {
 	Results []LookupResponse `json:"results"`
-	Table   string           `json:"table"`
+	Summary BatchSummary     `json:"summary"`
 }
 
-// BatchHandler performs multi lookup on newline separated input.
+// BatchHandler performs multi lookup on newline separated input, a JSON
+// array or a multipart CSV upload (see parseBatchUpload). With dedupe=true
+// (query or form field) repeated numbers are analysed only once.
 func BatchHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "batch endpoint expects POST", http.StatusMethodNotAllowed)
 		return
 	}
 
-	msisdns, err := parseBatchBody(r)
+	result, err := ReadBatch(w, r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		if r.Context().Err() == nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
 		return
 	}
 
-	results := make([]LookupResponse, 0, len(msisdns))
-	for _, value := range msisdns {
-		results = append(results, Analyze(value))
-	}
-
-	resp := batchResponse{
-		Results: results,
-		Table:   renderBatchTable(results),
-	}
-
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	json.NewEncoder(w).Encode(result)
 }
 
-func parseBatchBody(r *http.Request) ([]string, error) {
-	reader := io.LimitReader(r.Body, 1<<20) // 1MB cap for safety
-	raw, err := io.ReadAll(reader)
+// ReadBatch reads a batch request the way BatchHandler does and analyses it
+// with the default analyzer and worker pool, so other front ends can present
+// the result their own way. The error describes a bad request unless the
+// client went away, in which case r.Context().Err() is set as well.
+func ReadBatch(w http.ResponseWriter, r *http.Request) (BatchResult, error) {
+	entries, err := parseBatchBody(w, r)
+	if err == nil && len(entries) == 0 {
+		err = errors.New("empty batch payload")
+	}
 	if err != nil {
-		return nil, err
+		return BatchResult{}, err
 	}
 
-	payload := strings.TrimSpace(string(raw))
-	if payload == "" {
-		return nil, errors.New("empty batch payload")
+	// A multipart upload may carry the region as a field, as it does for
+	// /batch/export and /jobs; the query string wins.
+	region := r.URL.Query().Get("region")
+	if region == "" {
+		region = r.FormValue("region")
 	}
-
-	ct := r.Header.Get("Content-Type")
-	if strings.Contains(ct, "application/json") {
-		var list []string
-		if err := json.Unmarshal(raw, &list); err != nil {
-			return nil, errors.New("invalid JSON array payload")
-		}
-		return normalizeBatchList(list), nil
+	if region != "" && !Default().HasRegion(region) {
+		return BatchResult{}, errors.New("unknown region parameter")
 	}
 
-	lines := strings.Split(payload, "\n")
-	return normalizeBatchList(lines), nil
+	dedupe, _ := strconv.ParseBool(r.FormValue("dedupe"))
+	run, err := runBatch(r.Context(), DefaultWorkerPool(), Default(), entries, Options{Region: region}, dedupe)
+	if err != nil {
+		return BatchResult{}, err
+	}
+	return BatchResult{Results: run.results, Summary: run.summary}, nil
 }
 
-func normalizeBatchList(values []string) []string {
-	out := make([]string, 0, len(values))
-	for _, value := range values {
-		trimmed := strings.TrimSpace(value)
-		if trimmed == "" {
-			continue
+func parseBatchBody(w http.ResponseWriter, r *http.Request) ([]batchEntry, error) {
+	ct := r.Header.Get("Content-Type")
+	if strings.HasPrefix(ct, "multipart/form-data") {
+		upload, err := parseBatchUpload(w, r)
+		if err != nil {
+			return nil, err
 		}
-		out = append(out, trimmed)
+		return upload.entries(), nil
 	}
-	return out
-}
 
-func renderBatchTable(results []LookupResponse) string {
-	if len(results) == 0 {
-		return `<div class="muted">No inputs processed.</div>`
+	raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, currentBatchLimits().MaxBytes))
+	if err != nil {
+		return nil, err
 	}
 
-	var b strings.Builder
-	b.WriteString(`<table class="result-grid"><thead><tr>`)
-	b.WriteString("<th>#</th><th>Input</th><th>E.164</th><th>Country</th><th>Type</th><th>Operator</th><th>MCC</th><th>MNC</th><th>Valid</th>")
-	b.WriteString("</tr></thead><tbody>")
+	payload := string(raw)
+	if strings.TrimSpace(payload) == "" {
+		return nil, errors.New("empty batch payload")
+	}
 
-	for idx, res := range results {
-		country := template.HTMLEscapeString(res.Country)
-		numberType := template.HTMLEscapeString(res.NumberType)
-		operator := template.HTMLEscapeString(res.Operator)
-		input := template.HTMLEscapeString(res.Input)
-		e164 := template.HTMLEscapeString(res.E164)
-		mcc := res.MCC
-		if mcc == "" {
-			mcc = "N/A"
-		}
-		mnc := res.MNC
-		if mnc == "" {
-			mnc = "N/A"
-		}
-		valid := "No"
-		if res.Valid.DigitsOnly && res.Valid.KnownCountryCode && res.Valid.LengthOk {
-			valid = "Yes"
+	if strings.Contains(ct, "application/json") {
+		var list []string
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, errors.New("invalid JSON array payload")
 		}
-		b.WriteString("<tr>")
-		b.WriteString(fmt.Sprintf("<td>%d</td>", idx+1))
-		b.WriteString("<td>" + input + "</td>")
-		b.WriteString("<td>" + e164 + "</td>")
-		b.WriteString("<td>" + country + "</td>")
-		b.WriteString("<td>" + numberType + "</td>")
-		b.WriteString("<td>" + operator + "</td>")
-		b.WriteString("<td>" + template.HTMLEscapeString(mcc) + "</td>")
-		b.WriteString("<td>" + template.HTMLEscapeString(mnc) + "</td>")
-		b.WriteString("<td>" + valid + "</td>")
-		b.WriteString("</tr>")
+		return numberedBatchList(list), nil
 	}
 
-	b.WriteString("</tbody></table>")
-	return b.String()
+	return numberedBatchList(strings.Split(payload, "\n")), nil
 }
@@ -0,0 +1,104 @@
+package lookup
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RuleConflictError is returned when a rule set declares the same country
+// code, region or operator prefix more than once, or defines a malformed
+// range. Each entry names the offending rules.
+type RuleConflictError struct {
+	Conflicts []string
+}
+
+func (e *RuleConflictError) Error() string {
+	return fmt.Sprintf("lookup: %d invalid or conflicting rule(s): %s", len(e.Conflicts), strings.Join(e.Conflicts, "; "))
+}
+
+func describeDuplicate(what, first, second string) string {
+	if first == second {
+		return fmt.Sprintf("%s is declared more than once for %s", what, first)
+	}
+	return fmt.Sprintf("%s is declared for both %s and %s", what, first, second)
+}
+
+// ruleWarning is a non-fatal finding from compiling a rule set. Unreachable
+// marks operator prefixes that can never match at all, as opposed to ones that
+// are only partly covered by another country code.
+type ruleWarning struct {
+	Country     string
+	Message     string
+	Unreachable bool
+}
+
+func (w ruleWarning) String() string {
+	return w.Country + ": " + w.Message
+}
+
+// shadowedOperators lists operator rules that can never match (fully or in
+// part) because the numbers they cover resolve to a different country first.
+func (c *compiledRules) shadowedOperators(builds []*countryBuild, codes map[string]*countryIndex) []ruleWarning {
+	var warnings []ruleWarning
+	for _, build := range builds {
+		index := build.index
+		prefixes := make([]string, 0, len(build.prefixes))
+		for prefix := range build.prefixes {
+			prefixes = append(prefixes, prefix)
+		}
+		sort.Strings(prefixes)
+
+		for _, prefix := range prefixes {
+			op := build.prefixes[prefix]
+			owner, _ := c.findCountryRule(prefix)
+			switch {
+			case matchingCode(prefix, index.Codes) == "":
+				msg := fmt.Sprintf("operator prefix %s (%s) does not start with the country code", prefix, op.Name)
+				if owner != nil {
+					msg += fmt.Sprintf(", numbers starting with it resolve to %s", owner.Name)
+				}
+				warnings = append(warnings, ruleWarning{Country: index.Name, Message: msg, Unreachable: true})
+				continue
+			case owner != index:
+				warnings = append(warnings, ruleWarning{
+					Country:     index.Name,
+					Message:     fmt.Sprintf("operator prefix %s (%s) is unreachable, numbers starting with it resolve to %s", prefix, op.Name, owner.Name),
+					Unreachable: true,
+				})
+				continue
+			}
+
+			for code, other := range codes {
+				if other != index && len(code) > len(prefix) && strings.HasPrefix(code, prefix) {
+					warnings = append(warnings, ruleWarning{
+						Country: index.Name,
+						Message: fmt.Sprintf("operator prefix %s (%s) is partly shadowed by country code %s (%s)", prefix, op.Name, code, other.Name),
+					})
+				}
+			}
+		}
+
+		for _, block := range build.ranges {
+			if owner, _ := c.findCountryRule(block.start); owner != index {
+				warnings = append(warnings, ruleWarning{
+					Country:     index.Name,
+					Message:     fmt.Sprintf("operator range %s (%s) does not start with the country code", block.label, block.op.Name),
+					Unreachable: true,
+				})
+			}
+		}
+	}
+	return warnings
+}
+
+// Warnings lists non-fatal problems found while loading the active rules,
+// such as operator prefixes shadowed by another country's code.
+func (a *Analyzer) Warnings() []string {
+	warnings := a.currentRules().warnings
+	out := make([]string, 0, len(warnings))
+	for _, w := range warnings {
+		out = append(out, w.String())
+	}
+	return out
+}
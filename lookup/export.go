@@ -0,0 +1,469 @@
+package lookup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// csvColumns lists every LookupResponse field in the order exported files use.
+var csvColumns = []string{
+	"input", "normalized", "e164", "country", "numberType", "operator", "mcc", "mnc",
+	"digitsOnly", "knownCountryCode", "lengthOk",
+	"countryConfidence", "typeConfidence", "operatorConfidence",
+	"explainInput", "explainCountry", "explainType", "explainOperator",
+}
+
+// csvRecord flattens res into the columns named by csvColumns.
+func csvRecord(res LookupResponse) []string {
+	return []string{
+		res.Input, res.Normalized, res.E164, res.Country, res.NumberType, res.Operator, res.MCC, res.MNC,
+		strconv.FormatBool(res.Valid.DigitsOnly),
+		strconv.FormatBool(res.Valid.KnownCountryCode),
+		strconv.FormatBool(res.Valid.LengthOk),
+		res.CountryConfidence, res.TypeConfidence, res.OperatorConfidence,
+		res.Explain.Input, res.Explain.Country, res.Explain.Type, res.Explain.Operator,
+	}
+}
+
+// isValid reports whether every Validity check passed.
+func (v Validity) isValid() bool {
+	return v.DigitsOnly && v.KnownCountryCode && v.LengthOk
+}
+
+var errEmptyBatch = errors.New("lookup: batch contains no numbers")
+
+// BatchLimits caps the request bodies accepted by the package level batch
+// handlers.
+type BatchLimits struct {
+	// MaxBytes caps text and JSON bodies of /batch (default 1 MB).
+	MaxBytes int64
+	// MaxUploadBytes caps multipart uploads to /batch and /batch/export
+	// (default 32 MB).
+	MaxUploadBytes int64
+}
+
+var batchLimits atomic.Pointer[BatchLimits]
+
+// SetBatchLimits replaces the limits of the package level batch handlers.
+// Zero fields keep their default.
+func SetBatchLimits(l BatchLimits) {
+	if l.MaxBytes <= 0 {
+		l.MaxBytes = defaultMaxBatchBytes
+	}
+	if l.MaxUploadBytes <= 0 {
+		l.MaxUploadBytes = defaultMaxBatchUpload
+	}
+	batchLimits.Store(&l)
+}
+
+func currentBatchLimits() BatchLimits {
+	if l := batchLimits.Load(); l != nil {
+		return *l
+	}
+	return BatchLimits{MaxBytes: defaultMaxBatchBytes, MaxUploadBytes: defaultMaxBatchUpload}
+}
+
+const defaultMaxBatchUpload = 32 << 20
+
+// batchUpload is a batch read from a form: either an uploaded CSV file, whose
+// rows are kept so exports can carry the original columns, or pasted text
+// with one number per line.
+type batchUpload struct {
+	header []string // nil for pasted text
+	rows   [][]string
+	lines  []int // 1-based input line (CSV record) of each row
+	column int   // index of the MSISDN column in rows
+}
+
+// msisdnHeaders are the column names picked when no column is selected.
+var msisdnHeaders = []string{"msisdn", "msisdns", "phone", "phone number", "number", "mobile", "e164", "tel"}
+
+// parseBatchUpload reads a multipart/form-data batch. A "file" part is parsed
+// as CSV (comma or semicolon separated); "column" selects the MSISDN column
+// by header name or 1-based position and defaults to the first column named
+// like a phone number. Without a file the "numbers" field is used.
+func parseBatchUpload(w http.ResponseWriter, r *http.Request) (*batchUpload, error) {
+	limit := currentBatchLimits().MaxUploadBytes
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	if err := r.ParseMultipartForm(limit); err != nil {
+		return nil, err
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("file")
+	if errors.Is(err, http.ErrMissingFile) {
+		upload := &batchUpload{}
+		for _, entry := range numberedBatchList(strings.Split(r.FormValue("numbers"), "\n")) {
+			upload.rows = append(upload.rows, []string{entry.value})
+			upload.lines = append(upload.lines, entry.line)
+		}
+		if len(upload.rows) == 0 {
+			return nil, errors.New("empty batch payload")
+		}
+		return upload, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := readCSV(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("uploaded file is empty")
+	}
+	return selectColumn(rows, r.FormValue("column"))
+}
+
+func readCSV(r io.Reader) ([][]string, error) {
+	br := bufio.NewReader(r)
+	first, _ := br.Peek(4096)
+	if line, _, _ := bytes.Cut(first, []byte("\n")); bytes.Count(line, []byte(";")) > bytes.Count(line, []byte(",")) {
+		return newCSVReader(br, ';').ReadAll()
+	}
+	return newCSVReader(br, ',').ReadAll()
+}
+
+func newCSVReader(r io.Reader, comma rune) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	return reader
+}
+
+// selectColumn finds the MSISDN column. The first row is taken as a header
+// when it names the column or holds no digits in it.
+func selectColumn(rows [][]string, column string) (*batchUpload, error) {
+	first := rows[0]
+	index := -1
+	if column != "" {
+		if n, err := strconv.Atoi(column); err == nil {
+			index = n - 1
+		} else {
+			index = indexFold(first, column)
+		}
+		if index < 0 || index >= len(first) {
+			return nil, fmt.Errorf("column %q not found in the uploaded file", column)
+		}
+	} else {
+		for _, name := range msisdnHeaders {
+			if index = indexFold(first, name); index >= 0 {
+				break
+			}
+		}
+		if index < 0 {
+			index = 0
+		}
+	}
+
+	upload := &batchUpload{column: index, rows: rows}
+	if !strings.ContainsAny(first[index], "0123456789") {
+		upload.header, upload.rows = first, rows[1:]
+	}
+	offset := len(rows) - len(upload.rows)
+	upload.lines = make([]int, len(upload.rows))
+	for i := range upload.lines {
+		upload.lines[i] = i + offset + 1
+	}
+	return upload, nil
+}
+
+func indexFold(values []string, name string) int {
+	for i, value := range values {
+		if strings.EqualFold(strings.TrimSpace(value), name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// msisdn returns the number of row i.
+func (u *batchUpload) msisdn(i int) string {
+	if row := u.rows[i]; u.column < len(row) {
+		return strings.TrimSpace(row[u.column])
+	}
+	return ""
+}
+
+// entries lists the non-blank numbers in file order.
+func (u *batchUpload) entries() []batchEntry {
+	out := make([]batchEntry, 0, len(u.rows))
+	for i := range u.rows {
+		if value := u.msisdn(i); value != "" {
+			out = append(out, batchEntry{line: u.lines[i], value: value})
+		}
+	}
+	return out
+}
+
+// exportHeader is the original header (or column1..N when the file had
+// none) followed by the lookup columns. Pasted text only gets the latter.
+func (u *batchUpload) exportHeader() []string {
+	width := u.width()
+	header := make([]string, 0, width+len(csvColumns))
+	for i := 0; i < width; i++ {
+		if i < len(u.header) {
+			header = append(header, u.header[i])
+		} else {
+			header = append(header, "column"+strconv.Itoa(i+1))
+		}
+	}
+	return append(header, csvColumns...)
+}
+
+// width is the number of original columns carried into exports.
+func (u *batchUpload) width() int {
+	if u.header == nil && u.column == 0 && len(u.rows) > 0 && len(u.rows[0]) == 1 {
+		// pasted text or a single-column file: the input column says it all
+		return 0
+	}
+	width := len(u.header)
+	for _, row := range u.rows {
+		width = max(width, len(row))
+	}
+	return width
+}
+
+type rowWriter interface {
+	Write(record []string) error
+}
+
+var exportContentTypes = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// newRowWriter returns a writer for format ("csv" or "xlsx") and the func
+// that completes the file.
+func newRowWriter(w io.Writer, format string) (rowWriter, func() error) {
+	if format == "xlsx" {
+		xw := newXLSXWriter(w)
+		return xw, xw.Close
+	}
+	cw := &csvWriter{csv.NewWriter(w)}
+	return cw, func() error { cw.Flush(); return cw.Error() }
+}
+
+// csvWriter writes every cell through csvCell, so exported inputs and
+// uploaded columns cannot turn into spreadsheet formulas.
+type csvWriter struct {
+	*csv.Writer
+}
+
+func (w *csvWriter) Write(record []string) error {
+	escaped := make([]string, len(record))
+	for i, cell := range record {
+		escaped[i] = csvCell(cell)
+	}
+	return w.Writer.Write(escaped)
+}
+
+// csvCell prefixes a quote to cells a spreadsheet would evaluate: anything
+// starting with =, @, tab or CR, and + or - unless the rest is a plain
+// phone number such as +381 64 123-4567.
+func csvCell(cell string) string {
+	if cell == "" {
+		return cell
+	}
+	switch cell[0] {
+	case '=', '@', '\t', '\r':
+		return "'" + cell
+	case '+', '-':
+		if !isPlainPhoneNumber(cell[1:]) {
+			return "'" + cell
+		}
+	}
+	return cell
+}
+
+func isPlainPhoneNumber(s string) bool {
+	digits := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= '0' && c <= '9':
+			digits = true
+		case c == ' ' || c == '-' || c == '(' || c == ')' || c == '.' || c == '/':
+		default:
+			return false
+		}
+	}
+	return digits
+}
+
+// ExportOptions control Analyzer.ExportBatch.
+type ExportOptions struct {
+	// Column selects the MSISDN column by header name or 1-based position;
+	// when empty a column named like a phone number, else the first, is used.
+	Column string
+	Region string
+	// Dedupe leaves out rows repeating an earlier number.
+	Dedupe bool
+	// Format is "csv" (default), "xlsx", "json" (a BatchResponse) or
+	// "ndjson" (one LookupResponse per line).
+	Format string
+	// Pool analyses the entries; nil means DefaultWorkerPool().
+	Pool *WorkerPool
+}
+
+// ExportBatch reads a CSV file or a plain list of numbers from in, analyses
+// it and writes the results to out. CSV and XLSX output keep the original
+// columns like ExportHandler does. The summary lets callers tell whether
+// every number was valid.
+func (a *Analyzer) ExportBatch(ctx context.Context, in io.Reader, out io.Writer, opts ExportOptions) (BatchSummary, error) {
+	format := opts.Format
+	if format == "" {
+		format = "csv"
+	}
+	if _, ok := exportContentTypes[format]; !ok && format != "json" && format != "ndjson" {
+		return BatchSummary{}, fmt.Errorf("lookup: unknown export format %q", format)
+	}
+	if opts.Region != "" && !a.HasRegion(opts.Region) {
+		return BatchSummary{}, errUnknownRegion
+	}
+	pool := opts.Pool
+	if pool == nil {
+		pool = DefaultWorkerPool()
+	}
+
+	rows, err := readCSV(in)
+	if err != nil {
+		return BatchSummary{}, fmt.Errorf("lookup: unable to read batch: %w", err)
+	}
+	if len(rows) == 0 {
+		return BatchSummary{}, errEmptyBatch
+	}
+	upload, err := selectColumn(rows, opts.Column)
+	if err != nil {
+		return BatchSummary{}, err
+	}
+	run, err := runBatch(ctx, pool, a, upload.entries(), Options{Region: opts.Region}, opts.Dedupe)
+	if err != nil {
+		return BatchSummary{}, err
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(BatchResponse{Count: len(run.results), Results: run.results, Summary: run.summary})
+	case "ndjson":
+		bw := bufio.NewWriter(out)
+		enc := json.NewEncoder(bw)
+		for _, res := range run.results {
+			if err = enc.Encode(res); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = bw.Flush()
+		}
+	default:
+		w, finish := newRowWriter(out, format)
+		if err = writeExport(w, upload, run); err == nil {
+			err = finish()
+		}
+	}
+	return run.summary, err
+}
+
+// ExportHandler runs a batch from a multipart form (see parseBatchUpload) and
+// returns it as a CSV or XLSX file (form field "format") holding the
+// original columns plus every LookupResponse field. Rows without a number
+// keep their original columns and leave the lookup columns empty. With
+// "dedupe" set, rows repeating an earlier number are left out.
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "export endpoint expects POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		http.Error(w, "export endpoint expects multipart/form-data", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	upload, err := parseBatchUpload(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	region := r.FormValue("region")
+	if region != "" && !Default().HasRegion(region) {
+		http.Error(w, "unknown region parameter", http.StatusBadRequest)
+		return
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = "csv"
+	}
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		http.Error(w, "format must be csv or xlsx", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="lookup-results.`+format+`"`)
+	out, finish := newRowWriter(w, format)
+
+	dedupe, _ := strconv.ParseBool(r.FormValue("dedupe"))
+	run, err := runBatch(r.Context(), DefaultWorkerPool(), Default(), upload.entries(), Options{Region: region}, dedupe)
+	if err != nil {
+		return // client went away
+	}
+	// Headers are already sent, so a failure can only cut the download short.
+	writeExport(out, upload, run)
+	finish()
+}
+
+// writeExport writes the header and one record per uploaded row, skipping
+// rows whose number run did not analyse because it was a duplicate.
+func writeExport(out rowWriter, upload *batchUpload, run batchRun) error {
+	byLine := make(map[int]LookupResponse, len(run.results))
+	for i, entry := range run.entries {
+		byLine[entry.line] = run.results[i]
+	}
+
+	width := upload.width()
+	if err := out.Write(upload.exportHeader()); err != nil {
+		return err
+	}
+	record := make([]string, 0, width+len(csvColumns))
+	for i, row := range upload.rows {
+		res, analysed := byLine[upload.lines[i]]
+		hasNumber := upload.msisdn(i) != ""
+		if hasNumber && !analysed {
+			continue
+		}
+		record = record[:0]
+		for c := 0; c < width; c++ {
+			if c < len(row) {
+				record = append(record, row[c])
+			} else {
+				record = append(record, "")
+			}
+		}
+		if hasNumber {
+			record = append(record, csvRecord(res)...)
+		} else {
+			record = append(record, make([]string, len(csvColumns))...)
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
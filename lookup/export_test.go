@@ -0,0 +1,157 @@
+package lookup
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func multipartRequest(t *testing.T, target string, fields map[string]string, file string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	if file != "" {
+		part, _ := form.CreateFormFile("file", "numbers.csv")
+		io.WriteString(part, file)
+	}
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, target, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+const subscribersCSV = "id;Phone;plan\n7;0641234567;gold\n8;;silver\n9;+41791234567;bronze\n"
+
+func TestExportKeepsUploadedColumnsAndAppendsLookupFields(t *testing.T) {
+	rec := httptest.NewRecorder()
+	ExportHandler(rec, multipartRequest(t, "/batch/export", map[string]string{"column": "phone", "region": "RS"}, subscribersCSV))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body)
+	}
+
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || strings.Join(rows[0][:4], ",") != "id,Phone,plan,input" || len(rows[0]) != 3+len(csvColumns) {
+		t.Fatalf("unexpected header %v", rows[0])
+	}
+	e164 := 3 + indexFold(csvColumns, "e164")
+	mnc := 3 + indexFold(csvColumns, "mnc")
+	if rows[1][0] != "7" || rows[1][2] != "gold" || rows[1][e164] != "+381641234567" || rows[1][mnc] == "" {
+		t.Fatalf("unexpected first row %v", rows[1])
+	}
+	if rows[2][2] != "silver" || rows[2][e164] != "" {
+		t.Fatalf("rows without a number should keep their columns only, got %v", rows[2])
+	}
+	if rows[3][e164] != "+41791234567" {
+		t.Fatalf("unexpected last row %v", rows[3])
+	}
+}
+
+func TestExportEscapesSpreadsheetFormulas(t *testing.T) {
+	file := "Phone;note\n+381 64 123-4567;=HYPERLINK(\"http://evil\")\n@SUM(A1);-2+3\n+cmd|' /C calc'!A0;plain\n"
+	rec := httptest.NewRecorder()
+	ExportHandler(rec, multipartRequest(t, "/batch/export", map[string]string{"column": "1"}, file))
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil || len(rows) != 4 {
+		t.Fatalf("unexpected export %v: %v", rows, err)
+	}
+	input := 2 + indexFold(csvColumns, "input")
+	for _, c := range []struct{ got, want string }{
+		{rows[1][0], "+381 64 123-4567"},
+		{rows[1][1], `'=HYPERLINK("http://evil")`},
+		{rows[2][0], "'@SUM(A1)"},
+		{rows[2][1], "'-2+3"},
+		{rows[2][input], "'@SUM(A1)"},
+		{rows[3][0], "'+cmd|' /C calc'!A0"},
+		{rows[3][1], "plain"},
+		{csvCell("\tx"), "'\tx"},
+		{csvCell("\rx"), "'\rx"},
+		{csvCell("-"), "'-"},
+	} {
+		if c.got != c.want {
+			t.Fatalf("got %q, want %q in %v", c.got, c.want, rows)
+		}
+	}
+}
+
+func TestExportWritesXLSXWorkbook(t *testing.T) {
+	rec := httptest.NewRecorder()
+	ExportHandler(rec, multipartRequest(t, "/batch/export", map[string]string{"format": "xlsx", "numbers": "+393383260866\n<&>"}, ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("export is not a zip archive: %v", err)
+	}
+	parts := map[string]string{}
+	for _, f := range archive.File {
+		r, _ := f.Open()
+		data, _ := io.ReadAll(r)
+		parts[f.Name] = string(data)
+	}
+	sheet, ok := parts["xl/worksheets/sheet1.xml"]
+	if !ok || parts["[Content_Types].xml"] == "" || parts["xl/workbook.xml"] == "" {
+		t.Fatalf("workbook parts missing: %v", parts)
+	}
+	if strings.Count(sheet, "<row ") != 3 || !strings.Contains(sheet, "+393383260866") || !strings.Contains(sheet, "&lt;&amp;&gt;") {
+		t.Fatalf("unexpected sheet:\n%s", sheet)
+	}
+}
+
+func TestBatchHandlerAcceptsCSVUpload(t *testing.T) {
+	rec := httptest.NewRecorder()
+	BatchHandler(rec, multipartRequest(t, "/batch?region=RS", map[string]string{"column": "2"}, subscribersCSV))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body)
+	}
+	var resp BatchResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 2 || resp.Results[0].E164 != "+381641234567" {
+		t.Fatalf("unexpected results %+v", resp.Results)
+	}
+
+	// The region may also come as a form field; the query string wins.
+	for target, region := range map[string]string{"/batch": "RS", "/batch?region=RS": "nowhere"} {
+		rec = httptest.NewRecorder()
+		BatchHandler(rec, multipartRequest(t, target, map[string]string{"column": "2", "region": region}, subscribersCSV))
+		resp = BatchResult{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Results) != 2 || resp.Results[0].E164 != "+381641234567" {
+			t.Fatalf("%s with region field %s: unexpected response %d %s", target, region, rec.Code, rec.Body)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	BatchHandler(rec, multipartRequest(t, "/batch", map[string]string{"column": "msisdn"}, subscribersCSV))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `column "msisdn" not found`) {
+		t.Fatalf("expected unknown column to be rejected, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestExportDedupeDropsRepeatedNumbers(t *testing.T) {
+	file := subscribersCSV + "10;+381 64 123 4567;gold\n"
+	rec := httptest.NewRecorder()
+	ExportHandler(rec, multipartRequest(t, "/batch/export", map[string]string{"region": "RS", "dedupe": "true"}, file))
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || rows[3][0] != "9" {
+		t.Fatalf("expected the repeated number on line 5 to be dropped, got %v", rows)
+	}
+}
@@ -0,0 +1,122 @@
+package lookup
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Build metadata, injected at build time:
+//
+//	go build -ldflags "-X lookup/lookup.Version=1.4.0 -X lookup/lookup.Commit=$(git rev-parse --short HEAD)"
+//
+// When Commit is not set, the VCS revision Go stamps into binaries built
+// from a checkout is used instead.
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+// Health is the body of /healthz and /readyz.
+type Health struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// VersionInfo is the body of /version.
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	GoVersion string `json:"goVersion"`
+	RulesPath string `json:"rulesPath,omitempty"`
+	Checksum  string `json:"checksum"`
+	Countries int    `json:"countries"`
+	Operators int    `json:"operators"`
+}
+
+var errSelfTest = errors.New("lookup: self-test lookup did not resolve any country of the rules")
+
+// SelfTest checks that rules are loaded and that a number built from them
+// resolves to its country with a valid length.
+func (a *Analyzer) SelfTest() (err error) {
+	rules := a.currentRules()
+	if rules == nil {
+		return errors.New("lookup: no rules loaded")
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("lookup: self-test lookup panicked: %v", p)
+		}
+	}()
+
+	for _, country := range rules.countryTrie.values {
+		if country == nil || country.MinLength <= len(country.dialCode) {
+			continue
+		}
+		sample := "+" + country.dialCode + strings.Repeat("5", country.MinLength-len(country.dialCode))
+		if res := rules.resolve(sample, Options{}); res.Country == country.Name && res.Valid.LengthOk {
+			return nil
+		}
+	}
+	return errSelfTest
+}
+
+// Info reports the build and the active rule set.
+func (a *Analyzer) Info() VersionInfo {
+	status := a.Status()
+	return VersionInfo{
+		Version:   Version,
+		Commit:    buildCommit(),
+		GoVersion: runtime.Version(),
+		RulesPath: status.Path,
+		Checksum:  status.Checksum,
+		Countries: status.Countries,
+		Operators: status.Operators,
+	}
+}
+
+func buildCommit() string {
+	if Commit != "" {
+		return Commit
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+	if revision != "" && modified == "true" {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// HealthzHandler answers 200 as long as the process serves HTTP.
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Health{Status: "ok"})
+}
+
+// ReadyzHandler answers 200 once the default analyzer has rules and passes
+// SelfTest, 503 otherwise.
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	if err := Default().SelfTest(); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, Health{Status: "unavailable", Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, Health{Status: "ready"})
+}
+
+// VersionHandler reports the build and rule set of the default analyzer.
+func VersionHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Default().Info())
+}
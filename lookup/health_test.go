@@ -0,0 +1,54 @@
+package lookup
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSelfTestPassesForLoadedRules(t *testing.T) {
+	if err := LoadEmbedded().SelfTest(); err != nil {
+		t.Fatalf("embedded rules: %v", err)
+	}
+	custom, err := NewAnalyzer(strings.NewReader(`{"countries": [{"name": "Testland", "codes": ["999"], "minLength": 8, "maxLength": 8, "typeRules": [], "operatorRules": []}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := custom.SelfTest(); err != nil {
+		t.Fatalf("custom rules: %v", err)
+	}
+	broken, err := NewAnalyzer(strings.NewReader(`{"countries": [{"name": "Testland", "codes": ["999"], "minLength": 3, "maxLength": 3, "typeRules": [], "operatorRules": []}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := broken.SelfTest(); err == nil {
+		t.Fatal("rules no number can satisfy should fail the self-test")
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	for path, handler := range map[string]http.HandlerFunc{"/healthz": HealthzHandler, "/readyz": ReadyzHandler} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", path, rec.Code, rec.Body)
+		}
+	}
+
+	Commit = "abc1234"
+	defer func() { Commit = "" }()
+	rec := httptest.NewRecorder()
+	VersionHandler(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	var info VersionInfo
+	if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	status := Default().Status()
+	if info.Version != "dev" || info.Commit != "abc1234" || info.GoVersion != runtime.Version() ||
+		info.Checksum != status.Checksum || info.Countries == 0 || info.Operators == 0 {
+		t.Fatalf("unexpected version info: %+v", info)
+	}
+}
@@ -0,0 +1,361 @@
+package lookup
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HistoryEntry is one recorded lookup. The explanations of the result are
+// not kept because they may quote the number.
+type HistoryEntry struct {
+	Time time.Time `json:"time"`
+	// MSISDN is the E.164 form (the input when there is none) as allowed by
+	// the history's MaskPolicy.
+	MSISDN     string   `json:"msisdn"`
+	Country    string   `json:"country"`
+	NumberType string   `json:"numberType"`
+	Operator   string   `json:"operator"`
+	MCC        string   `json:"mcc,omitempty"`
+	MNC        string   `json:"mnc,omitempty"`
+	Valid      Validity `json:"valid"`
+}
+
+// HistoryConfig configures OpenHistory.
+type HistoryConfig struct {
+	// Path is the file entries are appended to, one JSON object per line.
+	Path string
+	// Retention is how long entries are kept; 0 keeps them forever.
+	Retention time.Duration
+	// Mask decides how numbers are stored (partial unless set).
+	Mask MaskPolicy
+	// MaxEntries caps how many of the newest entries are kept in memory
+	// for Query (default 100000, roughly 25 MB). Older ones stay in the
+	// file until they expire but are no longer searched.
+	MaxEntries int
+	// OnError is called when RecordHistory cannot write an entry. The
+	// lookup is answered anyway.
+	OnError func(error)
+}
+
+// History records lookups in an append-only file and keeps the newest of
+// them in memory for Query. Expire rewrites the file without the entries
+// past retention.
+type History struct {
+	cfg HistoryConfig
+	now func() time.Time
+
+	// expiring serializes Expire; mu guards the fields below it.
+	expiring sync.Mutex
+	mu       sync.Mutex
+	file     *os.File
+	entries  []HistoryEntry // in the order recorded
+	oldest   time.Time      // of the entries in the file, zero when empty
+}
+
+// OpenHistory loads the entries already in cfg.Path, creating the file if
+// needed. A line left incomplete by a crash is skipped.
+func OpenHistory(cfg HistoryConfig) (*History, error) {
+	if err := cfg.Mask.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = defaultHistoryEntries
+	}
+	h := &History{cfg: cfg, now: time.Now}
+
+	file, err := os.OpenFile(cfg.Path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("lookup: unable to open history: %w", err)
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	torn := false
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if torn = json.Unmarshal(scanner.Bytes(), &entry) != nil; !torn {
+			h.remember(entry)
+			h.oldest = earliest(h.oldest, entry.Time)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("lookup: unable to read history %s: %w", cfg.Path, err)
+	}
+	if torn {
+		// Start the next entry on a line of its own.
+		if _, err := file.Write([]byte("\n")); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("lookup: unable to write history: %w", err)
+		}
+	}
+	h.file = file
+	return h, nil
+}
+
+// Record appends the outcome of a lookup.
+func (h *History) Record(resp LookupResponse) error {
+	number := resp.E164
+	if number == "" {
+		number = resp.Input
+	}
+
+	// The clock is read under the lock so entries are appended in time
+	// order, as long as it does not go backwards.
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entry := HistoryEntry{
+		Time:       h.now().UTC(),
+		MSISDN:     h.cfg.Mask.Mask(number),
+		Country:    resp.Country,
+		NumberType: resp.NumberType,
+		Operator:   resp.Operator,
+		MCC:        resp.MCC,
+		MNC:        resp.MNC,
+		Valid:      resp.Valid,
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := h.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("lookup: unable to write history: %w", err)
+	}
+	h.remember(entry)
+	h.oldest = earliest(h.oldest, entry.Time)
+	return nil
+}
+
+// remember adds entry to the in-memory index, dropping the oldest one once
+// MaxEntries is reached. Slicing off the front lets append reallocate with
+// only the kept entries, so the memory stays proportional to MaxEntries.
+func (h *History) remember(entry HistoryEntry) {
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > h.cfg.MaxEntries {
+		h.entries = h.entries[len(h.entries)-h.cfg.MaxEntries:]
+	}
+}
+
+// HistoryFilter selects entries for Query. Zero fields match everything.
+type HistoryFilter struct {
+	// Country matches the country name, ignoring case.
+	Country string
+	// Operator matches any operator containing it, ignoring case.
+	Operator string
+	// From is inclusive, To exclusive.
+	From, To time.Time
+	Valid    *bool
+	// Limit caps the entries returned (default 50, at most 1000).
+	Limit int
+}
+
+// HistoryPage is the result of Query and the body of GET /v1/history.
+type HistoryPage struct {
+	// Total counts every matching entry, Entries holds the newest of them.
+	Total   int            `json:"total"`
+	Entries []HistoryEntry `json:"entries"`
+}
+
+const (
+	defaultHistoryLimit   = 50
+	maxHistoryLimit       = 1000
+	defaultHistoryEntries = 100000
+)
+
+// Query returns the entries matching f, newest first, among the MaxEntries
+// newest entries.
+func (h *History) Query(f HistoryFilter) HistoryPage {
+	limit := f.Limit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	limit = min(limit, maxHistoryLimit)
+	operator := strings.ToLower(f.Operator)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	page := HistoryPage{Entries: []HistoryEntry{}}
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		entry := h.entries[i]
+		switch {
+		case !f.From.IsZero() && entry.Time.Before(f.From),
+			!f.To.IsZero() && !entry.Time.Before(f.To),
+			f.Country != "" && !strings.EqualFold(entry.Country, f.Country),
+			operator != "" && !strings.Contains(strings.ToLower(entry.Operator), operator),
+			f.Valid != nil && entry.Valid.isValid() != *f.Valid:
+			continue
+		}
+		page.Total++
+		if len(page.Entries) < limit {
+			page.Entries = append(page.Entries, entry)
+		}
+	}
+	return page
+}
+
+// Expire drops the entries older than the retention period and rewrites the
+// file without them. It returns how many were removed. The file is copied
+// without holding the lock, so lookups keep being recorded meanwhile; the
+// lock is only taken to carry over what they appended and swap the files.
+func (h *History) Expire() (int, error) {
+	if h.cfg.Retention <= 0 {
+		return 0, nil
+	}
+	h.expiring.Lock()
+	defer h.expiring.Unlock()
+	cutoff := h.now().Add(-h.cfg.Retention)
+
+	// Record writes whole lines under the lock, so size ends on a line.
+	h.mu.Lock()
+	oldest := h.oldest
+	info, err := h.file.Stat()
+	h.mu.Unlock()
+	if err != nil {
+		return 0, fmt.Errorf("lookup: unable to rewrite history: %w", err)
+	}
+	if oldest.IsZero() || !oldest.Before(cutoff) {
+		return 0, nil
+	}
+
+	src, err := os.Open(h.cfg.Path)
+	if err != nil {
+		return 0, fmt.Errorf("lookup: unable to rewrite history: %w", err)
+	}
+	defer src.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(h.cfg.Path), ".history-*")
+	if err != nil {
+		return 0, fmt.Errorf("lookup: unable to rewrite history: %w", err)
+	}
+	swapped := false
+	defer func() {
+		if !swapped {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(tmp)
+	removed, kept, err := copyHistory(w, io.LimitReader(src, info.Size()), cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("lookup: unable to rewrite history: %w", err)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// Carry over what was recorded while copying; none of it is expired.
+	_, recent, err := copyHistory(w, src, time.Time{})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), h.cfg.Path)
+	}
+	if err != nil {
+		// The current file and its handle stay in use.
+		return 0, fmt.Errorf("lookup: unable to rewrite history: %w", err)
+	}
+	// tmp is now the file at Path, positioned at its end.
+	swapped = true
+	h.file.Close()
+	h.file = tmp
+
+	h.oldest = earliest(kept, recent)
+	entries := make([]HistoryEntry, 0, len(h.entries))
+	for _, entry := range h.entries {
+		if !entry.Time.Before(cutoff) {
+			entries = append(entries, entry)
+		}
+	}
+	h.entries = entries
+	return removed, nil
+}
+
+// copyHistory copies the lines of r that are not older than cutoff to w. It
+// returns how many lines it dropped and the earliest time it kept. Lines that
+// do not decode, such as one torn by a crash, are dropped too.
+func copyHistory(w io.Writer, r io.Reader, cutoff time.Time) (removed int, oldest time.Time, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil || entry.Time.Before(cutoff) {
+			removed++
+			continue
+		}
+		oldest = earliest(oldest, entry.Time)
+		if _, err := w.Write(scanner.Bytes()); err != nil {
+			return removed, oldest, err
+		}
+		if _, err := w.Write([]byte("\n")); err != nil {
+			return removed, oldest, err
+		}
+	}
+	return removed, oldest, scanner.Err()
+}
+
+// earliest returns the earlier of two times, ignoring zero ones.
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+// RunExpiry calls Expire every interval until ctx is cancelled.
+func (h *History) RunExpiry(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := h.Expire(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// Close closes the file. Record must not be called afterwards.
+func (h *History) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.file.Close()
+}
+
+var defaultHistory atomic.Pointer[History]
+
+// SetHistory makes h the history the package level lookup handlers record
+// into; nil turns recording off, the default.
+func SetHistory(h *History) {
+	defaultHistory.Store(h)
+}
+
+// DefaultHistory returns the history set with SetHistory, or nil.
+func DefaultHistory() *History {
+	return defaultHistory.Load()
+}
+
+// RecordHistory adds resp to DefaultHistory, if there is one. Front ends
+// outside this package call it for the lookups they serve.
+func RecordHistory(resp LookupResponse) {
+	h := DefaultHistory()
+	if h == nil {
+		return
+	}
+	if err := h.Record(resp); err != nil && h.cfg.OnError != nil {
+		h.cfg.OnError(err)
+	}
+}
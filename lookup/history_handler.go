@@ -0,0 +1,89 @@
+package lookup
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Register mounts GET /v1/history on mux.
+func (h *History) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/history", h.serveQuery)
+}
+
+// serveQuery answers with the entries matching the filter in the query
+// string, see ParseHistoryFilter.
+func (h *History) serveQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "history expects GET", "")
+		return
+	}
+	filter, err := ParseHistoryFilter(r.URL.Query())
+	if err != nil {
+		var invalid *invalidParameterError
+		errors.As(err, &invalid)
+		writeAPIError(w, http.StatusBadRequest, "invalid_parameter", err.Error(), invalid.field)
+		return
+	}
+	writeJSON(w, http.StatusOK, h.Query(filter))
+}
+
+// invalidParameterError names the query parameter ParseHistoryFilter could
+// not read.
+type invalidParameterError struct {
+	field, want string
+}
+
+func (e *invalidParameterError) Error() string {
+	return e.field + " must be " + e.want
+}
+
+// ParseHistoryFilter reads a HistoryFilter from the query parameters
+// country, operator, from, to, valid and limit. from and to take RFC 3339
+// times or dates; a date in to includes the whole day.
+func ParseHistoryFilter(q url.Values) (HistoryFilter, error) {
+	f := HistoryFilter{Country: q.Get("country"), Operator: q.Get("operator")}
+
+	var err error
+	if f.From, err = parseHistoryTime(q.Get("from"), false); err != nil {
+		return f, &invalidParameterError{"from", "an RFC 3339 time or a YYYY-MM-DD date"}
+	}
+	if f.To, err = parseHistoryTime(q.Get("to"), true); err != nil {
+		return f, &invalidParameterError{"to", "an RFC 3339 time or a YYYY-MM-DD date"}
+	}
+	if v := q.Get("valid"); v != "" {
+		valid, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, &invalidParameterError{"valid", "true or false"}
+		}
+		f.Valid = &valid
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 || f.Limit > maxHistoryLimit {
+			return f, &invalidParameterError{"limit", "between 1 and " + strconv.Itoa(maxHistoryLimit)}
+		}
+	}
+	return f, nil
+}
+
+// parseHistoryTime reads an RFC 3339 time or a UTC date. With endOfDay a
+// date stands for the following midnight, so it works as an exclusive end.
+func parseHistoryTime(s string, endOfDay bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
@@ -0,0 +1,184 @@
+package lookup
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHistoryRecordsMaskedLookupsAndFilters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	h, err := OpenHistory(HistoryConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	h.now = func() time.Time { return now }
+	for _, msisdn := range []string{"+381641234567", "+393383260866", "12"} {
+		if err := h.Record(Analyze(msisdn)); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(24 * time.Hour)
+	}
+	h.Close()
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "641234567") || !strings.Contains(string(data), `"msisdn":"+381*******67"`) {
+		t.Fatalf("numbers must be stored masked:\n%s", data)
+	}
+
+	h, err = OpenHistory(HistoryConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	mux := http.NewServeMux()
+	h.Register(mux)
+	query := func(q string) HistoryPage {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/history?"+q, nil))
+		var page HistoryPage
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &page) != nil {
+			t.Fatalf("%s: %d %s", q, rec.Code, rec.Body)
+		}
+		return page
+	}
+
+	if page := query(""); page.Total != 3 || page.Entries[0].MSISDN != "12" || page.Entries[2].Country != "Serbia" {
+		t.Fatalf("expected every entry newest first, got %+v", page)
+	}
+	if page := query("country=serbia"); page.Total != 1 {
+		t.Fatalf("country filter: %+v", page)
+	}
+	if page := query("valid=false"); page.Total != 1 || page.Entries[0].Valid.isValid() {
+		t.Fatalf("validity filter: %+v", page)
+	}
+	if page := query("from=2026-03-02&to=2026-03-02"); page.Total != 1 || page.Entries[0].Country != "Italy" {
+		t.Fatalf("date filter: %+v", page)
+	}
+	if page := query("limit=1"); page.Total != 3 || len(page.Entries) != 1 {
+		t.Fatalf("limit: %+v", page)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/history?from=yesterday", nil))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"field":"from"`) {
+		t.Fatalf("expected a bad from parameter to be rejected, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestHistoryExpireRewritesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	h, err := OpenHistory(HistoryConfig{Path: path, Retention: 48 * time.Hour, Mask: MaskPolicy{Mode: MaskNone}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	h.now = func() time.Time { return now }
+	for _, msisdn := range []string{"+381641234567", "+393383260866", "+41791234567"} {
+		h.Record(Analyze(msisdn))
+		now = now.Add(24 * time.Hour)
+	}
+	// An entry written after the clock went back must expire as well.
+	end := now
+	now = now.AddDate(0, 0, -5)
+	h.Record(Analyze("+38163111222"))
+	now = end
+
+	if removed, err := h.Expire(); err != nil || removed != 2 {
+		t.Fatalf("expected the two oldest entries to expire, got %d %v", removed, err)
+	}
+	if page := h.Query(HistoryFilter{}); page.Total != 2 {
+		t.Fatalf("expected 2 entries left in memory, got %+v", page)
+	}
+	h.Record(Analyze("+381641234567"))
+	h.Close()
+
+	data, _ := os.ReadFile(path)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 3 || !strings.Contains(lines[0], "+393383260866") || !strings.Contains(lines[2], "+381641234567") {
+		t.Fatalf("unexpected file after expiry:\n%s", data)
+	}
+
+	// A line torn by a crash is skipped and does not swallow the next one.
+	os.WriteFile(path, append(data, `{"time":"2026-03`...), 0o600)
+	h, err = OpenHistory(HistoryConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Record(Analyze("+41791234567"))
+	h.Close()
+	if h, err = OpenHistory(HistoryConfig{Path: path}); err != nil || h.Query(HistoryFilter{}).Total != 4 {
+		t.Fatalf("expected 4 entries after a torn line, got %v", err)
+	}
+	h.Close()
+}
+
+func TestHistoryKeepsOnlyTheNewestEntriesInMemory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	h, err := OpenHistory(HistoryConfig{Path: path, MaxEntries: 2, Mask: MaskPolicy{Mode: MaskNone}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msisdn := range []string{"+381641234567", "+393383260866", "+41791234567"} {
+		h.Record(Analyze(msisdn))
+	}
+	if page := h.Query(HistoryFilter{}); page.Total != 2 || page.Entries[1].MSISDN != "+393383260866" {
+		t.Fatalf("expected the 2 newest entries, got %+v", page)
+	}
+	h.Close()
+
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Fatalf("expected every entry in the file, got %d", lines)
+	}
+	h, err = OpenHistory(HistoryConfig{Path: path, MaxEntries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if page := h.Query(HistoryFilter{}); page.Total != 2 || page.Entries[0].MSISDN != "+41791234567" {
+		t.Fatalf("expected the 2 newest entries after reopening, got %+v", page)
+	}
+}
+
+func TestHistoryKeepsRecordingWhileExpiring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	h, err := OpenHistory(HistoryConfig{Path: path, Retention: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	resp := Analyze("+381641234567")
+	var clock atomic.Int64
+	clock.Store(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC).UnixNano())
+	h.now = func() time.Time { return time.Unix(0, clock.Load()) }
+	for i := 0; i < 5000; i++ {
+		h.Record(resp)
+	}
+	clock.Add(int64(2 * time.Hour))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 500; i++ {
+			h.Record(resp)
+		}
+	}()
+	if removed, err := h.Expire(); err != nil || removed != 5000 {
+		t.Fatalf("expected 5000 expired entries, got %d %v", removed, err)
+	}
+	<-done
+	h.Record(resp)
+
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 501 || h.Query(HistoryFilter{}).Total != 501 {
+		t.Fatalf("expected 501 entries in the file and in memory, got %d and %d", lines, h.Query(HistoryFilter{}).Total)
+	}
+}
@@ -0,0 +1,380 @@
+package lookup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrJobNotFound is returned by a JobStore for an unknown or expired job.
+var ErrJobNotFound = errors.New("lookup: job not found")
+
+// ErrJobStoreFull is returned by a MemoryJobStore when an input or result
+// would take it over its size limit.
+var ErrJobStoreFull = errors.New("lookup: job store is full")
+
+// JobStore keeps job metadata together with the uploaded input and the
+// produced results. Implementations must be safe for concurrent use.
+type JobStore interface {
+	// Create records a new job and stores its input.
+	Create(job Job, input io.Reader) error
+	Get(id string) (Job, error)
+	Update(job Job) error
+	List() ([]Job, error)
+	OpenInput(id string) (io.ReadCloser, error)
+	// CreateResult returns a writer for the job's results. They become
+	// visible to OpenResult once the writer is closed.
+	CreateResult(id string) (io.WriteCloser, error)
+	OpenResult(id string) (io.ReadCloser, error)
+	// Delete removes the job and everything stored for it.
+	Delete(id string) error
+}
+
+// MemoryJobStore keeps jobs in process memory. Jobs do not survive a restart.
+// The inputs and results it holds are capped in total, so an upload or a
+// result that does not fit fails with ErrJobStoreFull instead of exhausting
+// memory.
+type MemoryJobStore struct {
+	maxBytes int64
+
+	mu   sync.Mutex
+	used int64 // bytes of inputs and results held or being written
+	jobs map[string]*memoryJob
+}
+
+// DefaultMemoryJobBytes is the size limit of a MemoryJobStore unless
+// another one is given.
+const DefaultMemoryJobBytes = 256 << 20
+
+type memoryJob struct {
+	job    Job
+	input  []byte
+	result []byte
+}
+
+func (j *memoryJob) size() int64 { return int64(len(j.input) + len(j.result)) }
+
+// NewMemoryJobStore returns an empty in-memory store holding at most
+// maxBytes of inputs and results (DefaultMemoryJobBytes if not positive).
+func NewMemoryJobStore(maxBytes int64) *MemoryJobStore {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMemoryJobBytes
+	}
+	return &MemoryJobStore{maxBytes: maxBytes, jobs: make(map[string]*memoryJob)}
+}
+
+// reserve accounts for n more bytes, failing if they do not fit.
+func (s *MemoryJobStore) reserve(n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used+n > s.maxBytes {
+		return ErrJobStoreFull
+	}
+	s.used += n
+	return nil
+}
+
+func (s *MemoryJobStore) release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used -= n
+}
+
+func (s *MemoryJobStore) Create(job Job, input io.Reader) error {
+	s.mu.Lock()
+	room := s.maxBytes - s.used
+	s.mu.Unlock()
+	// Reading one byte past the room left tells an upload that does not fit
+	// without holding more of it.
+	data, err := io.ReadAll(io.LimitReader(input, room+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > room {
+		return ErrJobStoreFull
+	}
+	if err := s.reserve(int64(len(data))); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = &memoryJob{job: job, input: data}
+	return nil
+}
+
+func (s *MemoryJobStore) Get(id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return entry.job, nil
+}
+
+func (s *MemoryJobStore) Update(job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.jobs[job.ID]
+	if !ok {
+		return ErrJobNotFound
+	}
+	entry.job = job
+	return nil
+}
+
+func (s *MemoryJobStore) List() ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, entry := range s.jobs {
+		jobs = append(jobs, entry.job)
+	}
+	sortJobs(jobs)
+	return jobs, nil
+}
+
+func (s *MemoryJobStore) OpenInput(id string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return io.NopCloser(bytes.NewReader(entry.input)), nil
+}
+
+func (s *MemoryJobStore) CreateResult(id string) (io.WriteCloser, error) {
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+	return &memoryResult{store: s, id: id}, nil
+}
+
+func (s *MemoryJobStore) OpenResult(id string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.jobs[id]
+	if !ok || entry.result == nil {
+		return nil, ErrJobNotFound
+	}
+	return io.NopCloser(bytes.NewReader(entry.result)), nil
+}
+
+func (s *MemoryJobStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.jobs[id]
+	if !ok {
+		return ErrJobNotFound
+	}
+	s.used -= entry.size()
+	delete(s.jobs, id)
+	return nil
+}
+
+// memoryResult reserves room in the store as it grows and hands it over to
+// the job on Close.
+type memoryResult struct {
+	buf   bytes.Buffer
+	store *MemoryJobStore
+	id    string
+}
+
+func (r *memoryResult) Write(p []byte) (int, error) {
+	if err := r.store.reserve(int64(len(p))); err != nil {
+		return 0, err
+	}
+	return r.buf.Write(p)
+}
+
+func (r *memoryResult) Close() error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	entry, ok := r.store.jobs[r.id]
+	if !ok {
+		r.store.used -= int64(r.buf.Len())
+		return ErrJobNotFound
+	}
+	r.store.used -= int64(len(entry.result))
+	entry.result = r.buf.Bytes()
+	return nil
+}
+
+// FileJobStore keeps every job as three files in Dir: <id>.json with the
+// metadata, <id>.input and <id>.result. Jobs survive restarts and results
+// do not have to fit in memory.
+type FileJobStore struct {
+	Dir string
+
+	mu sync.Mutex // serialises metadata writes
+}
+
+// NewFileJobStore returns a store rooted at dir, creating it if needed.
+func NewFileJobStore(dir string) (*FileJobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("lookup: unable to create job directory: %w", err)
+	}
+	return &FileJobStore{Dir: dir}, nil
+}
+
+func (s *FileJobStore) path(id, ext string) (string, error) {
+	if !isJobID(id) {
+		return "", ErrJobNotFound
+	}
+	return filepath.Join(s.Dir, id+ext), nil
+}
+
+func (s *FileJobStore) Create(job Job, input io.Reader) error {
+	path, err := s.path(job.ID, ".input")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, func(w io.Writer) error {
+		_, err := io.Copy(w, input)
+		return err
+	}); err != nil {
+		return err
+	}
+	return s.Update(job)
+}
+
+func (s *FileJobStore) Get(id string) (Job, error) {
+	path, err := s.path(id, ".json")
+	if err != nil {
+		return Job{}, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Job{}, ErrJobNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return Job{}, fmt.Errorf("lookup: corrupt job %s: %w", id, err)
+	}
+	return job, nil
+}
+
+func (s *FileJobStore) Update(job Job) error {
+	path, err := s.path(job.ID, ".json")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeFileAtomic(path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(job)
+	})
+}
+
+func (s *FileJobStore) List() ([]Job, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []Job
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !isJobID(id) {
+			continue
+		}
+		job, err := s.Get(id)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sortJobs(jobs)
+	return jobs, nil
+}
+
+func (s *FileJobStore) OpenInput(id string) (io.ReadCloser, error) {
+	return s.open(id, ".input")
+}
+
+func (s *FileJobStore) CreateResult(id string) (io.WriteCloser, error) {
+	path, err := s.path(id, ".result")
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(s.Dir, id+".result-*")
+	if err != nil {
+		return nil, err
+	}
+	return &fileResult{File: f, path: path}, nil
+}
+
+func (s *FileJobStore) OpenResult(id string) (io.ReadCloser, error) {
+	return s.open(id, ".result")
+}
+
+func (s *FileJobStore) open(id, ext string) (io.ReadCloser, error) {
+	path, err := s.path(id, ext)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrJobNotFound
+	}
+	return f, err
+}
+
+func (s *FileJobStore) Delete(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	for _, ext := range []string{".input", ".result", ".json"} {
+		path, _ := s.path(id, ext)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileResult is renamed into place on Close so readers never see a partial
+// result file.
+type fileResult struct {
+	*os.File
+	path string
+}
+
+func (f *fileResult) Close() error {
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), f.path)
+}
+
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func sortJobs(jobs []Job) {
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+}
@@ -0,0 +1,496 @@
+package lookup
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobStatus is the lifecycle state of an asynchronous batch job.
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobDone      JobStatus = "done"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+func (s JobStatus) finished() bool {
+	return s == JobDone || s == JobFailed || s == JobCancelled
+}
+
+// Job describes an asynchronous batch lookup. Failed counts numbers that
+// did not pass every Validity check; they are still part of the result.
+type Job struct {
+	ID         string     `json:"id"`
+	Status     JobStatus  `json:"status"`
+	Region     string     `json:"region,omitempty"`
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Failed     int        `json:"failed"`
+	ETASeconds int        `json:"etaSeconds,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+}
+
+// jobRecord is one line of a job's NDJSON result.
+type jobRecord struct {
+	Line   int            `json:"line"`
+	Result LookupResponse `json:"result"`
+}
+
+var (
+	errUnknownRegion  = errors.New("lookup: region is not defined in the rules")
+	errEmptyJob       = errors.New("lookup: job input contains no numbers")
+	errJobFinished    = errors.New("lookup: job has already finished")
+	errJobNotFinished = errors.New("lookup: job has not finished yet")
+	errJobFormat      = errors.New("lookup: unknown result format")
+	errShuttingDown   = errors.New("lookup: server is shutting down")
+)
+
+// JobConfig tunes a JobManager. Zero values select the defaults.
+type JobConfig struct {
+	// Workers is how many jobs run at the same time (default 2).
+	Workers int
+	// Retention is how long finished jobs and their results are kept
+	// (default 24h).
+	Retention time.Duration
+	// MaxUpload caps the size of an uploaded file (default 512 MB, or the
+	// batch upload limit when jobs are kept in a MemoryJobStore).
+	MaxUpload int64
+}
+
+func (c JobConfig) withDefaults(store JobStore) JobConfig {
+	if c.Workers <= 0 {
+		c.Workers = 2
+	}
+	if c.Retention <= 0 {
+		c.Retention = 24 * time.Hour
+	}
+	if _, inMemory := store.(*MemoryJobStore); inMemory && c.MaxUpload <= 0 {
+		c.MaxUpload = currentBatchLimits().MaxUploadBytes
+	}
+	if c.MaxUpload <= 0 {
+		c.MaxUpload = 512 << 20
+	}
+	return c
+}
+
+// JobManager runs batch lookups in the background so large files do not
+// hold an HTTP connection open. Job state lives in a JobStore.
+type JobManager struct {
+	analyzer *Analyzer
+	store    JobStore
+	cfg      JobConfig
+	slots    chan struct{}
+	now      func() time.Time
+
+	mu      sync.Mutex
+	active  map[string]*activeJob
+	closing bool
+}
+
+type activeJob struct {
+	cancel context.CancelCauseFunc
+	done   chan struct{}
+}
+
+// NewJobManager returns a manager that analyses with a (nil means
+// Default()) and keeps jobs in store. Jobs the store still reports as queued
+// or running were interrupted by a restart and are marked failed.
+func NewJobManager(a *Analyzer, store JobStore, cfg JobConfig) *JobManager {
+	cfg = cfg.withDefaults(store)
+	m := &JobManager{
+		analyzer: a,
+		store:    store,
+		cfg:      cfg,
+		slots:    make(chan struct{}, cfg.Workers),
+		now:      func() time.Time { return time.Now().UTC() },
+		active:   make(map[string]*activeJob),
+	}
+	if jobs, err := store.List(); err == nil {
+		for _, job := range jobs {
+			if !job.Status.finished() {
+				m.finish(&job, JobFailed, "interrupted by a restart")
+			}
+		}
+	}
+	return m
+}
+
+func (m *JobManager) analyzerOrDefault() *Analyzer {
+	if m.analyzer != nil {
+		return m.analyzer
+	}
+	return Default()
+}
+
+// Submit stores input (one number per line) and queues it for analysis.
+func (m *JobManager) Submit(input io.Reader, region string) (Job, error) {
+	if region != "" && !m.analyzerOrDefault().HasRegion(region) {
+		return Job{}, errUnknownRegion
+	}
+	if m.isClosing() {
+		return Job{}, errShuttingDown
+	}
+
+	job := Job{ID: newJobID(), Status: JobQueued, Region: region, CreatedAt: m.now()}
+	counter := &lineCounter{r: input}
+	if err := m.store.Create(job, counter); err != nil {
+		return Job{}, err
+	}
+	job.Total = counter.lines()
+	if job.Total == 0 {
+		m.store.Delete(job.ID)
+		return Job{}, errEmptyJob
+	}
+	if err := m.store.Update(job); err != nil {
+		return Job{}, err
+	}
+	recordBatch("job", job.Total)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	run := &activeJob{cancel: cancel, done: make(chan struct{})}
+	m.mu.Lock()
+	if m.closing {
+		m.mu.Unlock()
+		cancel(nil)
+		m.store.Delete(job.ID)
+		return Job{}, errShuttingDown
+	}
+	m.active[job.ID] = run
+	m.mu.Unlock()
+
+	go func() {
+		defer close(run.done)
+		defer cancel(nil)
+		m.run(ctx, job)
+		m.mu.Lock()
+		delete(m.active, job.ID)
+		m.mu.Unlock()
+	}()
+	return job, nil
+}
+
+// Get returns the current state of a job, including an ETA while it runs.
+func (m *JobManager) Get(id string) (Job, error) {
+	job, err := m.store.Get(id)
+	if err != nil {
+		return Job{}, err
+	}
+	if job.Status == JobRunning && job.StartedAt != nil && job.Processed > 0 {
+		elapsed := m.now().Sub(*job.StartedAt)
+		remaining := time.Duration(float64(elapsed) / float64(job.Processed) * float64(job.Total-job.Processed))
+		job.ETASeconds = int(remaining.Round(time.Second) / time.Second)
+	}
+	return job, nil
+}
+
+// Cancel stops a queued or running job and waits until it has wound down.
+// Results produced so far are discarded.
+func (m *JobManager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	run, ok := m.active[id]
+	m.mu.Unlock()
+	if !ok {
+		job, err := m.store.Get(id)
+		if err != nil {
+			return Job{}, err
+		}
+		return job, errJobFinished
+	}
+	run.cancel(nil)
+	<-run.done
+	return m.store.Get(id)
+}
+
+// Shutdown stops accepting jobs and waits for the queued and running ones to
+// finish. When ctx ends first, the remaining jobs are stopped, marked failed
+// and ctx's error is returned.
+func (m *JobManager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.closing = true
+	runs := make([]*activeJob, 0, len(m.active))
+	for _, run := range m.active {
+		runs = append(runs, run)
+	}
+	m.mu.Unlock()
+
+	for i, run := range runs {
+		select {
+		case <-run.done:
+		case <-ctx.Done():
+			for _, rest := range runs[i:] {
+				rest.cancel(errShuttingDown)
+			}
+			for _, rest := range runs[i:] {
+				<-rest.done
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (m *JobManager) isClosing() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closing
+}
+
+// Wait blocks until the job is no longer queued or running, or ctx ends.
+func (m *JobManager) Wait(ctx context.Context, id string) (Job, error) {
+	m.mu.Lock()
+	run, ok := m.active[id]
+	m.mu.Unlock()
+	if ok {
+		select {
+		case <-run.done:
+		case <-ctx.Done():
+			return Job{}, ctx.Err()
+		}
+	}
+	return m.store.Get(id)
+}
+
+// WriteResult copies the results of a finished job to w as "ndjson" (one
+// jobRecord per line) or "csv" (a header row, then the input line number and
+// every LookupResponse field).
+func (m *JobManager) WriteResult(w io.Writer, id, format string) error {
+	if format != "ndjson" && format != "csv" {
+		return errJobFormat
+	}
+	job, err := m.store.Get(id)
+	if err != nil {
+		return err
+	}
+	if job.Status != JobDone {
+		return errJobNotFinished
+	}
+	result, err := m.store.OpenResult(id)
+	if err != nil {
+		return err
+	}
+	defer result.Close()
+
+	if format == "ndjson" {
+		_, err = io.Copy(w, result)
+		return err
+	}
+
+	out := &csvWriter{csv.NewWriter(w)}
+	out.Write(append([]string{"line"}, csvColumns...))
+	dec := json.NewDecoder(result)
+	for {
+		var rec jobRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		out.Write(append([]string{strconv.Itoa(rec.Line)}, csvRecord(rec.Result)...))
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// Expire deletes finished jobs whose retention has passed and returns how
+// many were removed.
+func (m *JobManager) Expire() (int, error) {
+	jobs, err := m.store.List()
+	if err != nil {
+		return 0, err
+	}
+	now, removed := m.now(), 0
+	for _, job := range jobs {
+		if job.ExpiresAt == nil || job.ExpiresAt.After(now) {
+			continue
+		}
+		if err := m.store.Delete(job.ID); err != nil && !errors.Is(err, ErrJobNotFound) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// RunExpiry calls Expire every interval until ctx is cancelled.
+func (m *JobManager) RunExpiry(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := m.Expire(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// progressEvery bounds how often a running job writes its counters back to
+// the store.
+const progressEvery = time.Second
+
+func (m *JobManager) run(ctx context.Context, job Job) {
+	select {
+	case m.slots <- struct{}{}:
+		defer func() { <-m.slots }()
+	case <-ctx.Done():
+		status, message := m.stoppedStatus(ctx)
+		m.finish(&job, status, message)
+		return
+	}
+
+	started := m.now()
+	job.Status, job.StartedAt = JobRunning, &started
+	m.store.Update(job)
+
+	status, err := m.process(ctx, &job)
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+	if status == JobCancelled {
+		status, message = m.stoppedStatus(ctx)
+	}
+	m.finish(&job, status, message)
+}
+
+// stoppedStatus tells a job cancelled by a client apart from one cut short
+// by Shutdown, which is reported as a failure so it can be resubmitted.
+func (m *JobManager) stoppedStatus(ctx context.Context) (JobStatus, string) {
+	if context.Cause(ctx) == errShuttingDown {
+		return JobFailed, "interrupted by shutdown"
+	}
+	return JobCancelled, ""
+}
+
+func (m *JobManager) process(ctx context.Context, job *Job) (JobStatus, error) {
+	input, err := m.store.OpenInput(job.ID)
+	if err != nil {
+		return JobFailed, err
+	}
+	defer input.Close()
+
+	result, err := m.store.CreateResult(job.ID)
+	if err != nil {
+		return JobFailed, err
+	}
+	out := bufio.NewWriter(result)
+	enc := json.NewEncoder(out)
+
+	analyzer := m.analyzerOrDefault()
+	opts := Options{Region: job.Region}
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 4096), maxStreamLine)
+	lastUpdate, line := m.now(), 0
+	for scanner.Scan() {
+		line++
+		if ctx.Err() != nil {
+			result.Close()
+			return JobCancelled, nil
+		}
+		value := strings.TrimSpace(scanner.Text())
+		if value == "" {
+			continue
+		}
+
+		res := analyzer.AnalyzeWith(value, opts)
+		if err := enc.Encode(jobRecord{Line: line, Result: res}); err != nil {
+			result.Close()
+			return JobFailed, err
+		}
+		job.Processed++
+		if !res.Valid.isValid() {
+			job.Failed++
+		}
+		if now := m.now(); now.Sub(lastUpdate) >= progressEvery {
+			lastUpdate = now
+			m.store.Update(*job)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		result.Close()
+		return JobFailed, fmt.Errorf("line %d: %w", line+1, err)
+	}
+	if err := out.Flush(); err != nil {
+		result.Close()
+		return JobFailed, err
+	}
+	if err := result.Close(); err != nil {
+		return JobFailed, err
+	}
+	return JobDone, nil
+}
+
+func (m *JobManager) finish(job *Job, status JobStatus, message string) {
+	finished := m.now()
+	expires := finished.Add(m.cfg.Retention)
+	job.Status, job.Error = status, message
+	job.FinishedAt, job.ExpiresAt = &finished, &expires
+	job.ETASeconds = 0
+	m.store.Update(*job)
+}
+
+func newJobID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func isJobID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// lineCounter counts the non-blank lines read through it.
+type lineCounter struct {
+	r       io.Reader
+	count   int
+	pending bool // the current line has a non-space character
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	for _, b := range p[:n] {
+		switch b {
+		case '\n':
+			if c.pending {
+				c.count++
+			}
+			c.pending = false
+		case ' ', '\t', '\r':
+		default:
+			c.pending = true
+		}
+	}
+	return n, err
+}
+
+func (c *lineCounter) lines() int {
+	if c.pending {
+		return c.count + 1
+	}
+	return c.count
+}
@@ -0,0 +1,128 @@
+package lookup
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Register mounts the job endpoints on mux:
+//
+//	POST /jobs                 upload a file, returns the queued Job
+//	GET  /jobs/{id}            progress of a job
+//	POST /jobs/{id}/cancel     stop a queued or running job
+//	GET  /jobs/{id}/result     download the results (?format=csv|ndjson)
+func (m *JobManager) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /jobs", m.serveSubmit)
+	mux.HandleFunc("GET /jobs/{id}", m.serveStatus)
+	mux.HandleFunc("POST /jobs/{id}/cancel", m.serveCancel)
+	mux.HandleFunc("GET /jobs/{id}/result", m.serveResult)
+}
+
+// serveSubmit accepts either a multipart form with a "file" part (and an
+// optional "region" field) or a raw text body with the region in the query.
+func (m *JobManager) serveSubmit(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, m.cfg.MaxUpload)
+	region := r.URL.Query().Get("region")
+
+	var input io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "missing_parameter", "multipart upload needs a file part", "file")
+			return
+		}
+		defer file.Close()
+		input = file
+		if value := r.FormValue("region"); value != "" {
+			region = value
+		}
+	}
+
+	job, err := m.Submit(input, region)
+	switch {
+	case errors.Is(err, errUnknownRegion):
+		writeAPIError(w, http.StatusBadRequest, "unknown_region", "region is not defined in the rules", "region")
+	case errors.Is(err, errEmptyJob):
+		writeAPIError(w, http.StatusBadRequest, "empty_batch", "upload contains no numbers", "file")
+	case errors.Is(err, ErrJobStoreFull):
+		writeAPIError(w, http.StatusRequestEntityTooLarge, "job_store_full", "the jobs kept in memory have no room for this upload, try again once older jobs expire", "file")
+	case errors.Is(err, errShuttingDown):
+		w.Header().Set("Retry-After", "30")
+		writeAPIError(w, http.StatusServiceUnavailable, "shutting_down", "server is shutting down, try again shortly", "")
+	case err != nil:
+		writeBodyError(w, err)
+	default:
+		noteBatch(r.Context(), job.Total)
+		// relative, so it also resolves below a path prefix
+		w.Header().Set("Location", "jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+func (m *JobManager) serveStatus(w http.ResponseWriter, r *http.Request) {
+	job, err := m.Get(r.PathValue("id"))
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (m *JobManager) serveCancel(w http.ResponseWriter, r *http.Request) {
+	job, err := m.Cancel(r.PathValue("id"))
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (m *JobManager) serveResult(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "ndjson"
+	}
+	job, err := m.store.Get(id)
+	if err == nil && job.Status != JobDone {
+		err = errJobNotFinished
+	}
+	if err == nil && format != "ndjson" && format != "csv" {
+		err = errJobFormat
+	}
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+
+	contentType := "application/x-ndjson"
+	if format == "csv" {
+		contentType = "text/csv"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="lookup-`+id+`.`+format+`"`)
+	// Headers are already sent, so a failure can only cut the download short.
+	m.WriteResult(w, id, format)
+}
+
+func writeJobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		writeAPIError(w, http.StatusNotFound, "not_found", "no such job", "id")
+	case errors.Is(err, errJobFinished):
+		writeAPIError(w, http.StatusConflict, "job_finished", "job has already finished", "")
+	case errors.Is(err, errJobNotFinished):
+		writeAPIError(w, http.StatusConflict, "job_not_finished", "results are available once the job is done", "")
+	case errors.Is(err, errJobFormat):
+		writeAPIError(w, http.StatusBadRequest, "invalid_format", "format must be csv or ndjson", "format")
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "internal", err.Error(), "")
+	}
+}
@@ -0,0 +1,195 @@
+package lookup
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobUploadProgressAndDownload(t *testing.T) {
+	m := NewJobManager(nil, NewMemoryJobStore(0), JobConfig{})
+	mux := http.NewServeMux()
+	m.Register(mux)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("region", "RS")
+	part, _ := form.CreateFormFile("file", "numbers.txt")
+	part.Write([]byte("0641234567\n\n+41791234567\n12\n"))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/jobs", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body)
+	}
+	var job Job
+	json.Unmarshal(rec.Body.Bytes(), &job)
+	if job.ID == "" || job.Total != 3 || rec.Header().Get("Location") != "jobs/"+job.ID {
+		t.Fatalf("unexpected job %+v (Location %q)", job, rec.Header().Get("Location"))
+	}
+
+	if _, err := m.Wait(context.Background(), job.ID); err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs/"+job.ID, nil))
+	json.Unmarshal(rec.Body.Bytes(), &job)
+	if job.Status != JobDone || job.Processed != 3 || job.Failed != 1 || job.ExpiresAt == nil {
+		t.Fatalf("unexpected finished job %+v", job)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs/"+job.ID+"/result?format=csv", nil))
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil || rec.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("expected a CSV download, got %q: %v", rec.Header().Get("Content-Type"), err)
+	}
+	if len(rows) != 4 || len(rows[0]) != len(csvColumns)+1 || rows[1][0] != "1" || rows[2][0] != "3" || rows[1][3] != "+381641234567" {
+		t.Fatalf("unexpected CSV rows %v", rows)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs/"+job.ID+"/result", nil))
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	var record jobRecord
+	if len(lines) != 3 || json.Unmarshal([]byte(lines[1]), &record) != nil || record.Line != 3 || record.Result.Country != "Switzerland" {
+		t.Fatalf("unexpected NDJSON result %q", rec.Body)
+	}
+}
+
+func TestJobMemoryStoreRejectsWhatDoesNotFit(t *testing.T) {
+	SetBatchLimits(BatchLimits{MaxUploadBytes: 64})
+	defer SetBatchLimits(BatchLimits{})
+	store := NewMemoryJobStore(1 << 10)
+	m := NewJobManager(nil, store, JobConfig{Workers: 1})
+	mux := http.NewServeMux()
+	m.Register(mux)
+	submit := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(body)))
+		return rec
+	}
+
+	// Uploads to the memory store default to the batch upload limit.
+	if rec := submit(strings.Repeat("+381641234567\n", 5)); rec.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rec.Body.String(), "payload_too_large") {
+		t.Fatalf("expected an oversized upload to get 413, got %d %s", rec.Code, rec.Body)
+	}
+
+	// A result that outgrows the store fails the job instead.
+	rec := submit("+381641234567\n+381641234567\n+381641234567\n")
+	var job Job
+	if rec.Code != http.StatusAccepted || json.Unmarshal(rec.Body.Bytes(), &job) != nil {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body)
+	}
+	if job, _ = m.Wait(context.Background(), job.ID); job.Status != JobFailed || job.Error != ErrJobStoreFull.Error() {
+		t.Fatalf("expected the job to fail on a full store, got %+v", job)
+	}
+
+	// Once the input fills the store, further uploads are refused.
+	store.Delete(job.ID)
+	if err := store.Create(Job{ID: "filler"}, strings.NewReader(strings.Repeat("x", 1000))); err != nil {
+		t.Fatal(err)
+	}
+	if rec := submit("+381641234567\n+381641234567\n"); rec.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rec.Body.String(), "job_store_full") {
+		t.Fatalf("expected a full store to refuse the upload, got %d %s", rec.Code, rec.Body)
+	}
+	store.Delete("filler")
+	if rec := submit("+381641234567\n"); rec.Code != http.StatusAccepted {
+		t.Fatalf("deleting jobs should free the store, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestJobCancelStopsQueuedJob(t *testing.T) {
+	m := NewJobManager(nil, NewMemoryJobStore(0), JobConfig{Workers: 1})
+	m.slots <- struct{}{} // keep the only worker busy
+
+	job, err := m.Submit(strings.NewReader("+381641234567\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err = m.Cancel(job.ID)
+	if err != nil || job.Status != JobCancelled {
+		t.Fatalf("expected a cancelled job, got %+v: %v", job, err)
+	}
+	if _, err := m.Cancel(job.ID); err != errJobFinished {
+		t.Fatalf("cancelling twice should report errJobFinished, got %v", err)
+	}
+	if err := m.WriteResult(&bytes.Buffer{}, job.ID, "csv"); err != errJobNotFinished {
+		t.Fatalf("cancelled jobs have no result, got %v", err)
+	}
+}
+
+func TestJobShutdownDrainsThenStopsRemainingJobs(t *testing.T) {
+	m := NewJobManager(nil, NewMemoryJobStore(0), JobConfig{Workers: 1})
+	done, err := m.Submit(strings.NewReader("+393383260866\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Wait(context.Background(), done.ID); err != nil {
+		t.Fatal(err)
+	}
+	m.slots <- struct{}{} // keep the only worker busy so the next job stays queued
+	stuck, err := m.Submit(strings.NewReader("+381641234567\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected the deadline to cut the drain short, got %v", err)
+	}
+	if job, _ := m.Get(stuck.ID); job.Status != JobFailed || job.Error != "interrupted by shutdown" {
+		t.Fatalf("expected the queued job to be failed by shutdown, got %+v", job)
+	}
+	if job, _ := m.Get(done.ID); job.Status != JobDone {
+		t.Fatalf("finished jobs are left alone, got %+v", job)
+	}
+	if _, err := m.Submit(strings.NewReader("+41791234567\n"), ""); err != errShuttingDown {
+		t.Fatalf("submissions after shutdown should be refused, got %v", err)
+	}
+}
+
+func TestFileJobStoreExpiresJobsAndRecoversAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileJobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewJobManager(nil, store, JobConfig{Retention: time.Hour})
+	job, err := m.Submit(strings.NewReader("+393383260866\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Wait(context.Background(), job.ID)
+
+	interrupted := Job{ID: newJobID(), Status: JobRunning, CreatedAt: time.Now()}
+	store.Create(interrupted, strings.NewReader("+41791234567\n"))
+
+	restarted := NewJobManager(nil, store, JobConfig{Retention: time.Hour})
+	if got, _ := restarted.Get(interrupted.ID); got.Status != JobFailed || got.Error == "" {
+		t.Fatalf("expected interrupted job to be marked failed, got %+v", got)
+	}
+	if got, _ := restarted.Get(job.ID); got.Status != JobDone {
+		t.Fatalf("expected finished job to survive a restart, got %+v", got)
+	}
+
+	restarted.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if removed, err := restarted.Expire(); err != nil || removed != 2 {
+		t.Fatalf("expected both jobs to expire, removed %d: %v", removed, err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 0 {
+		t.Fatalf("expired jobs left files behind: %v", files)
+	}
+}
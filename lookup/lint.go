@@ -0,0 +1,198 @@
+package lookup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// LintIssue describes one structural problem found in a rules file.
+type LintIssue struct {
+	Severity string `json:"severity"`
+	Country  string `json:"country,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (i LintIssue) String() string {
+	if i.Country == "" {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Country, i.Message)
+}
+
+// HasLintErrors reports whether any issue is severe enough to reject the file.
+func HasLintErrors(issues []LintIssue) bool {
+	for _, issue := range issues {
+		if issue.Severity == LintError {
+			return true
+		}
+	}
+	return false
+}
+
+// LintFile lints the rules file at path. See LintRules.
+func LintFile(path string) ([]LintIssue, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("lookup: unable to load rules: %w", err)
+	}
+	defer f.Close()
+	return LintRules(f)
+}
+
+// LintRules parses rules the same way the analyzer does and reports every
+// structural problem it finds instead of stopping at the first one. The error
+// is only set when the document cannot be read or decoded at all.
+func LintRules(r io.Reader) ([]LintIssue, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("lookup: unable to read rules: %w", err)
+	}
+	var set RuleSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("lookup: unable to parse rules: %w", err)
+	}
+
+	var issues []LintIssue
+	for i := range set.Countries {
+		issues = append(issues, lintCountry(&set.Countries[i])...)
+	}
+
+	compiled, conflicts := buildRules(set.clone())
+	for _, msg := range conflicts {
+		issues = append(issues, LintIssue{Severity: LintError, Message: msg})
+	}
+	if len(compiled.countryTrie.values) == 0 {
+		issues = append(issues, LintIssue{Severity: LintError, Message: "no country prefixes loaded"})
+	}
+	for _, w := range compiled.warnings {
+		severity := LintWarning
+		if w.Unreachable {
+			severity = LintError
+		}
+		issues = append(issues, LintIssue{Severity: severity, Country: w.Country, Message: w.Message})
+	}
+
+	return issues, nil
+}
+
+func lintCountry(country *CountryRule) []LintIssue {
+	var issues []LintIssue
+	report := func(severity, format string, args ...any) {
+		issues = append(issues, LintIssue{Severity: severity, Country: country.Name, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if country.Name == "" {
+		report(LintError, "country without a name (codes %v)", country.Codes)
+	}
+	if len(country.Codes) == 0 {
+		report(LintError, "no country codes")
+	}
+	for _, code := range country.Codes {
+		// non-numeric codes are reported by buildRules
+		if code == "" {
+			report(LintError, "empty country code")
+		}
+	}
+	if country.MinLength < 0 || country.MaxLength < 0 {
+		report(LintError, "negative length bounds (minLength %d, maxLength %d)", country.MinLength, country.MaxLength)
+	}
+	if country.MaxLength > 0 && country.MinLength > country.MaxLength {
+		report(LintError, "minLength %d is greater than maxLength %d", country.MinLength, country.MaxLength)
+	}
+
+	for _, region := range country.Regions {
+		if len(region) != 2 || strings.ToUpper(region) != region || strings.ToLower(region) == region {
+			report(LintError, "region %q must be an upper-case ISO 3166-1 alpha-2 code", region)
+		}
+	}
+	if country.TrunkPrefix != "" && !isDigits(country.TrunkPrefix) {
+		report(LintError, "trunk prefix %q is not numeric", country.TrunkPrefix)
+	}
+	if country.InternationalPrefix != "" && !isDigits(country.InternationalPrefix) {
+		report(LintError, "international prefix %q is not numeric", country.InternationalPrefix)
+	}
+
+	fallbacks := 0
+	for i, rule := range country.TypeRules {
+		if rule.isRange() {
+			if rule.Prefix != "" {
+				report(LintError, "type rule %q (%s) sets both a prefix and a range", rule.Prefix, rule.Type)
+			}
+			continue
+		}
+		if rule.Prefix == "" {
+			fallbacks++
+			continue
+		}
+		if !isDigits(rule.Prefix) {
+			report(LintError, "type rule prefix %q is not numeric", rule.Prefix)
+		}
+		for _, earlier := range country.TypeRules[:i] {
+			if earlier.Prefix != "" && !earlier.isRange() && strings.HasPrefix(rule.Prefix, earlier.Prefix) {
+				report(LintError, "type rule %q (%s) is unreachable behind earlier prefix %q (%s)", rule.Prefix, rule.Type, earlier.Prefix, earlier.Type)
+				break
+			}
+		}
+	}
+	if fallbacks > 1 {
+		report(LintError, "%d fallback type rules (prefix \"\"), only the first one is used", fallbacks)
+	}
+
+	for _, op := range country.OperatorRules {
+		if op.isRange() {
+			if op.Prefix != "" {
+				report(LintError, "operator rule %q sets both a prefix and a range", op.Operator)
+			}
+			// malformed ranges are reported by compileRuleSet
+			if code := matchingCode(op.From, country.Codes); code != "" && isDigits(op.From) {
+				if numberType, _ := resolvePrefixType(op.From[len(code):], country); numberType == "mobile" && (op.MCC == "" || op.MNC == "") {
+					report(LintWarning, "mobile operator range %s–%s (%s) is missing MCC/MNC", op.From, op.To, op.Operator)
+				}
+			}
+			continue
+		}
+		if op.Prefix == "" {
+			report(LintError, "operator rule %q has an empty prefix", op.Operator)
+			continue
+		}
+		// non-numeric prefixes and prefixes outside the country code are
+		// reported by buildRules
+		code := matchingCode(op.Prefix, country.Codes)
+		if code == "" {
+			continue
+		}
+		if numberType, _ := resolvePrefixType(op.Prefix[len(code):], country); numberType == "mobile" && (op.MCC == "" || op.MNC == "") {
+			report(LintWarning, "mobile operator prefix %s (%s) is missing MCC/MNC", op.Prefix, op.Operator)
+		}
+	}
+
+	return issues
+}
+
+// matchingCode returns the longest country code that prefixes value.
+func matchingCode(value string, codes []string) string {
+	best := ""
+	for _, code := range codes {
+		if code != "" && strings.HasPrefix(value, code) && len(code) > len(best) {
+			best = code
+		}
+	}
+	return best
+}
+
+func isDigits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return value != ""
+}
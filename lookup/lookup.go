@@ -2,11 +2,16 @@ package lookup
 
 // Country returns the detected country based on dial code prefixes.
 func Country(msisdn string) string {
+	return Default().Country(msisdn)
+}
+
+// Country returns the detected country based on dial code prefixes.
+func (a *Analyzer) Country(msisdn string) string {
 	normalized := normalize(msisdn)
 	if normalized == "" {
 		return "Unknown"
 	}
-	if rule, _ := findCountryRule(normalized); rule != nil {
+	if rule, _ := a.currentRules().findCountryRule(normalized); rule != nil {
 		return rule.Name
 	}
 	return "Unknown"
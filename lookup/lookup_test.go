@@ -1,6 +1,13 @@
 package lookup
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
 func TestCountry(t *testing.T) {
 	cases := []struct {
@@ -136,3 +143,408 @@ func TestAnalyzeExposesMccAndMnc(t *testing.T) {
 		}
 	}
 }
+
+func TestReloadKeepsPreviousSetOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	valid := `{"countries": [{"name": "Testland", "codes": ["381"], "minLength": 11, "maxLength": 12}]}`
+	if err := os.WriteFile(path, []byte(valid), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"countries": [`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Reload(); err == nil {
+		t.Fatalf("expected malformed rules to be rejected")
+	}
+	if got := a.Country("+38164123456"); got != "Testland" {
+		t.Fatalf("previous rules should stay active, got %s", got)
+	}
+	if status := a.Status(); status.LastError == "" || status.Source != "file" || status.Path != path {
+		t.Fatalf("status should report the rejected reload: %+v", status)
+	}
+
+	valid = strings.Replace(valid, "Testland", "Reloadland", 1)
+	if err := os.WriteFile(path, []byte(valid), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Reload(); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if got := a.Country("+38164123456"); got != "Reloadland" {
+		t.Fatalf("reloaded rules not applied, got %s", got)
+	}
+	if got := Country("+38164123456"); got != "Serbia" {
+		t.Fatalf("default analyzer must be unaffected, got %s", got)
+	}
+}
+
+func TestOverlayMergesFileOntoEmbeddedRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overlay.json")
+	overlay := `{"countries": [
+		{"name": "Serbia", "codes": ["381"], "minLength": 11, "maxLength": 12,
+		 "operatorRules": [{"prefix": "38164", "operator": "Overlay mts", "mcc": "220", "mnc": "03"}]},
+		{"name": "Overlayland", "codes": ["999"]}
+	]}`
+	if err := os.WriteFile(path, []byte(overlay), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := Open(Source{Path: path, Overlay: true})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if got := a.Operator("+381641234567"); got != "Overlay mts" {
+		t.Fatalf("overlay country should replace the embedded one, got %s", got)
+	}
+	if got := a.Country("+393383260866"); got != "Italy" {
+		t.Fatalf("embedded countries should survive the overlay, got %s", got)
+	}
+	if got := a.Country("+9991234567"); got != "Overlayland" {
+		t.Fatalf("overlay should add new countries, got %s", got)
+	}
+
+	status := a.Status()
+	if status.Source != "overlay" || !strings.HasPrefix(status.Checksum, "sha256:") || status.EmbeddedChecksum == "" {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if embedded := LoadEmbedded().Status(); embedded.Source != "embedded" || embedded.Checksum != status.EmbeddedChecksum {
+		t.Fatalf("unexpected embedded status: %+v", embedded)
+	}
+}
+
+func TestAnalyzersWithSeparateRuleSetsCoexist(t *testing.T) {
+	fixture := `{"countries": [{
+		"name": "Fixtureland",
+		"codes": ["999"],
+		"minLength": 10,
+		"maxLength": 10,
+		"typeRules": [{"prefix": "1", "type": "mobile"}],
+		"operatorRules": [{"prefix": "9991", "operator": "Fixture Mobile", "mcc": "901", "mnc": "42"}]
+	}]}`
+	fromReader, err := NewAnalyzer(strings.NewReader(fixture))
+	if err != nil {
+		t.Fatalf("NewAnalyzer: %v", err)
+	}
+
+	set := RuleSet{Countries: []CountryRule{{Name: "Memoryland", Codes: []string{"999"}}}}
+	fromSet, err := FromRuleSet(set)
+	if err != nil {
+		t.Fatalf("FromRuleSet: %v", err)
+	}
+	set.Countries[0].Name = "Mutated"
+
+	resp := fromReader.Analyze("+9991234567")
+	if resp.Country != "Fixtureland" || resp.NumberType != "mobile" || resp.Operator != "Fixture Mobile" || !resp.Valid.LengthOk {
+		t.Fatalf("unexpected analysis from fixture rules: %+v", resp)
+	}
+	if got := fromSet.Country("+9991234567"); got != "Memoryland" {
+		t.Fatalf("FromRuleSet analyzer should keep its own copy of the rules, got %s", got)
+	}
+	if got := Country("+9991234567"); got != "Unknown" {
+		t.Fatalf("default analyzer must not see fixture rules, got %s", got)
+	}
+	if err := fromReader.Reload(); err == nil {
+		t.Fatalf("expected reader backed analyzer to refuse Reload")
+	}
+
+	if _, err := NewAnalyzer(strings.NewReader(`{"countries": []}`)); err == nil {
+		t.Fatalf("expected empty rule set to be rejected")
+	}
+}
+
+func TestOperatorRulesAreScopedToResolvedCountry(t *testing.T) {
+	a, err := FromRuleSet(RuleSet{Countries: []CountryRule{
+		{Name: "Alpha", Codes: []string{"77"}, OperatorRules: []OperatorRule{{Prefix: "881", Operator: "Stray Operator"}}},
+		{Name: "Beta", Codes: []string{"88"}},
+	}})
+	if err != nil {
+		t.Fatalf("FromRuleSet: %v", err)
+	}
+	if got := a.Operator("+881234567"); got != "Unknown" {
+		t.Fatalf("operator rule of Alpha must not match a Beta number, got %s", got)
+	}
+	if warnings := a.Warnings(); len(warnings) != 1 || !strings.Contains(warnings[0], "881") || !strings.Contains(warnings[0], "Beta") {
+		t.Fatalf("expected a warning about the shadowed prefix, got %v", warnings)
+	}
+}
+
+func TestDuplicatePrefixesAreRejectedAtLoad(t *testing.T) {
+	_, err := FromRuleSet(RuleSet{Countries: []CountryRule{
+		{Name: "Alpha", Codes: []string{"77"}, OperatorRules: []OperatorRule{
+			{Prefix: "771", Operator: "First"},
+			{Prefix: "771", Operator: "Second"},
+		}},
+		{Name: "Gamma", Codes: []string{"77"}},
+	}})
+
+	var conflict *RuleConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected RuleConflictError, got %v", err)
+	}
+	if len(conflict.Conflicts) != 2 {
+		t.Fatalf("expected both conflicts to be listed, got %v", conflict.Conflicts)
+	}
+	for _, want := range []string{"First and Second", "Alpha and Gamma"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("conflict report %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestLintRulesReportsStructuralProblems(t *testing.T) {
+	rules := `{"countries": [{
+		"name": "Lintland",
+		"codes": ["38x"],
+		"minLength": 12,
+		"maxLength": 10,
+		"typeRules": [
+			{"prefix": "6", "type": "mobile"},
+			{"prefix": "64", "type": "mobile"},
+			{"prefix": "", "type": "fixed"},
+			{"prefix": "", "type": "unknown"}
+		],
+		"operatorRules": []
+	}, {
+		"name": "Opland",
+		"codes": ["77"],
+		"typeRules": [{"prefix": "6", "type": "mobile"}],
+		"operatorRules": [
+			{"prefix": "7761", "operator": "No Network Codes"},
+			{"prefix": "7861", "operator": "Misplaced"}
+		]
+	}]}`
+
+	issues, err := LintRules(strings.NewReader(rules))
+	if err != nil {
+		t.Fatalf("LintRules: %v", err)
+	}
+	if !HasLintErrors(issues) {
+		t.Fatalf("expected lint errors, got %v", issues)
+	}
+
+	var report strings.Builder
+	for _, issue := range issues {
+		report.WriteString(issue.String() + "\n")
+	}
+	for _, want := range []string{
+		`country code "38x"`,
+		"minLength 12 is greater than maxLength 10",
+		`type rule "64" (mobile) is unreachable`,
+		"2 fallback type rules",
+		"7761 (No Network Codes) is missing MCC/MNC",
+		"7861 (Misplaced) does not start with the country code",
+	} {
+		if !strings.Contains(report.String(), want) {
+			t.Errorf("lint report is missing %q:\n%s", want, report.String())
+		}
+	}
+}
+
+func TestLintRulesAcceptsBundledRules(t *testing.T) {
+	issues, err := LintFile("rules.json")
+	if err != nil {
+		t.Fatalf("LintFile: %v", err)
+	}
+	if HasLintErrors(issues) {
+		t.Fatalf("bundled rules should lint clean, got %v", issues)
+	}
+}
+
+func TestAnalyzeWithRegionReconstructsNationalInput(t *testing.T) {
+	cases := []struct {
+		input    string
+		region   string
+		e164     string
+		country  string
+		operator string
+		explain  string
+	}{
+		{"064 123 4567", "RS", "+381641234567", "Serbia", "Telekom Srbija (mts original range)", "trunk prefix 0 dropped"},
+		{"338 326 0866", "IT", "+393383260866", "Italy", "TIM Italy (338 prefix)", "country code +39 added"},
+		{"06 3691 8899", "it", "+390636918899", "Italy", "Italy fixed (Rome 06)", "country code +39 added"},
+		{"079 123 45 67", "CH", "+41791234567", "Switzerland", "Swisscom Mobile (079 prefix)", "trunk prefix 0 dropped"},
+		{"00 39 338 326 0866", "RS", "+393383260866", "Italy", "TIM Italy (338 prefix)", "international call prefix 00"},
+		{"+38164123456", "IT", "+38164123456", "Serbia", "Telekom Srbija (mts original range)", "leading +"},
+	}
+
+	for _, tc := range cases {
+		resp := AnalyzeWith(tc.input, Options{Region: tc.region})
+		if resp.E164 != tc.e164 || resp.Country != tc.country || resp.Operator != tc.operator {
+			t.Fatalf("%s (%s) -> got %s / %s / %s", tc.input, tc.region, resp.E164, resp.Country, resp.Operator)
+		}
+		if !strings.Contains(resp.Explain.Input, tc.explain) {
+			t.Fatalf("%s (%s) -> explanation %q should mention %q", tc.input, tc.region, resp.Explain.Input, tc.explain)
+		}
+	}
+
+	if resp := Analyze("064 123 4567"); resp.Country == "Serbia" || resp.Explain.Input != "" {
+		t.Fatalf("input should not be reinterpreted without a region: %+v", resp)
+	}
+	if Default().HasRegion("XX") || !Default().HasRegion("rs") {
+		t.Fatalf("unexpected region lookup result")
+	}
+}
+
+func TestRangeRulesResolveMostSpecificBlock(t *testing.T) {
+	a, err := NewAnalyzer(strings.NewReader(`{"countries": [{
+		"name": "Serbia",
+		"codes": ["381"],
+		"minLength": 11,
+		"maxLength": 12,
+		"typeRules": [
+			{"from": "381690000000", "to": "381690999999", "type": "m2m", "explanation": "069 0 block for IoT"},
+			{"prefix": "6", "type": "mobile"},
+			{"prefix": "", "type": "fixed"}
+		],
+		"operatorRules": [
+			{"prefix": "38164", "operator": "mts", "mcc": "220", "mnc": "03"},
+			{"from": "381641000000", "to": "381644999999", "operator": "Ported block", "explanation": "regulator allocation", "mcc": "220", "mnc": "05"},
+			{"from": "381642000000", "to": "381642009999", "operator": "Tiny block", "mcc": "220", "mnc": "09"},
+			{"from": "38169000000", "to": "38169999999", "minLength": 11, "maxLength": 12, "operator": "A1 any length", "mcc": "220", "mnc": "05"}
+		]
+	}]}`))
+	if err != nil {
+		t.Fatalf("NewAnalyzer: %v", err)
+	}
+
+	cases := []struct {
+		msisdn   string
+		operator string
+		numType  string
+		explain  string
+	}{
+		{"+381640123456", "mts", "mobile", ""},
+		{"+381643123456", "Ported block", "mobile", "block 381641000000–381644999999 -> regulator allocation"},
+		{"+381642001234", "Tiny block", "mobile", "block 381642000000–381642009999"},
+		{"+38164312345", "mts", "mobile", ""},
+		{"+381690123456", "A1 any length", "m2m", "block 38169000000–38169999999"},
+		{"+38169123456", "A1 any length", "mobile", ""},
+	}
+	for _, tc := range cases {
+		resp := a.Analyze(tc.msisdn)
+		if resp.Operator != tc.operator || resp.NumberType != tc.numType {
+			t.Fatalf("%s -> got %s/%s, want %s/%s", tc.msisdn, resp.Operator, resp.NumberType, tc.operator, tc.numType)
+		}
+		if !strings.Contains(resp.Explain.Operator, tc.explain) {
+			t.Fatalf("%s -> explanation %q should cite %q", tc.msisdn, resp.Explain.Operator, tc.explain)
+		}
+	}
+
+	_, err = NewAnalyzer(strings.NewReader(`{"countries": [{"name": "Bad", "codes": ["381"],
+		"operatorRules": [{"from": "38164999", "to": "38164000", "operator": "Backwards"}]}]}`))
+	if err == nil || !strings.Contains(err.Error(), "starts after it ends") {
+		t.Fatalf("expected inverted range to be rejected, got %v", err)
+	}
+}
+
+// largeNumberingPlan builds a Serbia-like plan with the given number of
+// prefix rules and as many range blocks, mimicking a full national plan.
+func largeNumberingPlan(blocks int) RuleSet {
+	country := CountryRule{Name: "Bigland", Codes: []string{"381"}, MinLength: 11, MaxLength: 12}
+	for i := 0; i < blocks; i++ {
+		country.OperatorRules = append(country.OperatorRules,
+			OperatorRule{Prefix: fmt.Sprintf("3816%05d", i), Operator: fmt.Sprintf("Prefix %d", i)},
+			OperatorRule{
+				From:     fmt.Sprintf("3817%05d000", i),
+				To:       fmt.Sprintf("3817%05d499", i),
+				Operator: fmt.Sprintf("Block %d", i),
+			})
+	}
+	return RuleSet{Countries: []CountryRule{country, {Name: "Italy", Codes: []string{"39"}}}}
+}
+
+func mustAnalyzer(tb testing.TB, set RuleSet) *Analyzer {
+	tb.Helper()
+	a, err := FromRuleSet(set)
+	if err != nil {
+		tb.Fatalf("FromRuleSet: %v", err)
+	}
+	return a
+}
+
+func TestPrefixIndexMatchesWithoutAllocating(t *testing.T) {
+	a := mustAnalyzer(t, largeNumberingPlan(10000))
+	rules := a.currentRules()
+
+	if got := a.Operator("+381601234567"); got != "Prefix 1234" {
+		t.Fatalf("unexpected prefix match %s", got)
+	}
+	if got := a.Operator("+381701234123"); got != "Block 1234" {
+		t.Fatalf("unexpected range match %s", got)
+	}
+	if got := a.Operator("+381701234678"); got != "Unknown" {
+		t.Fatalf("number outside the block should not match, got %s", got)
+	}
+
+	allocs := testing.AllocsPerRun(1000, func() {
+		country, _ := rules.findCountryRule("381701234123")
+		if op, _, _ := country.matchOperator("381701234123"); op == nil {
+			t.Fatal("expected a match")
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("longest-prefix match allocated %.1f times per lookup", allocs)
+	}
+}
+
+func BenchmarkFindCountryRule(b *testing.B) {
+	rules := Default().currentRules()
+	numbers := []string{"393383260866", "381641234567", "41791234567", "306971234567", "12025550123"}
+	b.ReportAllocs()
+	for i := 0; b.Loop(); i++ {
+		rules.findCountryRule(numbers[i%len(numbers)])
+	}
+}
+
+func BenchmarkMatchOperatorLargePlan(b *testing.B) {
+	a := mustAnalyzer(b, largeNumberingPlan(50000))
+	country, _ := a.currentRules().findCountryRule("381612345678")
+	numbers := []string{"381601234567", "381749999123", "381600000999", "381701234678"}
+	b.ReportAllocs()
+	for i := 0; b.Loop(); i++ {
+		country.matchOperator(numbers[i%len(numbers)])
+	}
+}
+
+func BenchmarkLongestPrefixMatch1MBatch(b *testing.B) {
+	a := mustAnalyzer(b, largeNumberingPlan(50000))
+	rules := a.currentRules()
+	numbers := make([]string, 1_000_000)
+	for i := range numbers {
+		numbers[i] = fmt.Sprintf("381%d%05d%03d", 6+i%2, i%50000, i%1000)
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		for _, msisdn := range numbers {
+			if country, _ := rules.findCountryRule(msisdn); country != nil {
+				country.matchOperator(msisdn)
+			}
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(numbers)), "ns/number")
+}
+
+func TestDefaultFallsBackToEmbeddedRulesAndReportsTheError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.json")
+	a := openOrEmbedded(Source{Path: path})
+	if a.LastError() == nil || !strings.Contains(a.LastError().Error(), "missing.json") {
+		t.Fatalf("expected the load error to be kept, got %v", a.LastError())
+	}
+	if got := a.Country("+381641234567"); got != "Serbia" {
+		t.Fatalf("embedded rules should be served, got %s", got)
+	}
+
+	valid := `{"countries": [{"name": "Testland", "codes": ["381"], "minLength": 11, "maxLength": 12}]}`
+	if err := os.WriteFile(path, []byte(valid), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Reload(); err != nil || a.LastError() != nil {
+		t.Fatalf("expected a successful reload to clear the error, got %v %v", err, a.LastError())
+	}
+}
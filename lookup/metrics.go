@@ -0,0 +1,240 @@
+package lookup
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsRegistry holds every metric the package exports. A private
+// registry keeps the output limited to what is declared here plus the Go
+// runtime and process collectors.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lookup_http_requests_total",
+		Help: "HTTP requests by route pattern, method and status code.",
+	}, []string{"endpoint", "method", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "lookup_http_request_duration_seconds",
+		Help:    "Time spent serving HTTP requests by route pattern.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"endpoint"})
+
+	batchSizes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "lookup_batch_size",
+		Help:    "Entries per batch by kind (batch, stream or job).",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+	}, []string{"kind"})
+
+	lookupResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lookup_results_total",
+		Help: "Analysed numbers by country and number type.",
+	}, []string{"country", "number_type"})
+
+	lookupOperators = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lookup_operator_results_total",
+		Help: "Analysed numbers by country and operator.",
+	}, []string{"country", "operator"})
+
+	lookupValidity = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lookup_validity_total",
+		Help: "Analysed numbers that passed every validity check or failed at least one.",
+	}, []string{"result"})
+
+	lookupFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lookup_validity_failures_total",
+		Help: "Failed validity checks by check.",
+	}, []string{"check"})
+
+	authRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lookup_auth_rejected_total",
+		Help: "Requests refused by API key authentication or limits, by reason.",
+	}, []string{"reason"})
+
+	rulesReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lookup_rules_reloads_total",
+		Help: "Rules reload attempts by result (ok or error).",
+	}, []string{"result"})
+)
+
+// The label sets below are fixed, so their children are resolved once
+// instead of on every lookup.
+var (
+	lookupsValid          = lookupValidity.WithLabelValues("valid")
+	lookupsInvalid        = lookupValidity.WithLabelValues("invalid")
+	failedDigitsOnly      = lookupFailures.WithLabelValues("digits_only")
+	failedKnownCountry    = lookupFailures.WithLabelValues("known_country_code")
+	failedLength          = lookupFailures.WithLabelValues("length")
+	rulesReloadsSucceeded = rulesReloads.WithLabelValues("ok")
+	rulesReloadsFailed    = rulesReloads.WithLabelValues("error")
+)
+
+var (
+	rulesInfoDesc = prometheus.NewDesc("lookup_rules_info",
+		"Active rule set; the checksum identifies its version.",
+		[]string{"source", "path", "checksum"}, nil)
+	rulesLoadedDesc = prometheus.NewDesc("lookup_rules_loaded_timestamp_seconds",
+		"Unix time the active rule set was loaded.", nil, nil)
+	rulesCountriesDesc = prometheus.NewDesc("lookup_rules_countries",
+		"Countries in the active rule set.", nil, nil)
+	rulesLastErrorDesc = prometheus.NewDesc("lookup_rules_last_reload_failed",
+		"1 when the most recent load or reload of the rules failed.", nil, nil)
+)
+
+// rulesCollector reports the default analyzer's rule set at scrape time.
+type rulesCollector struct{}
+
+func (rulesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rulesInfoDesc
+	ch <- rulesLoadedDesc
+	ch <- rulesCountriesDesc
+	ch <- rulesLastErrorDesc
+}
+
+func (rulesCollector) Collect(ch chan<- prometheus.Metric) {
+	status := Default().Status()
+	failed := 0.0
+	if status.LastError != "" {
+		failed = 1
+	}
+	ch <- prometheus.MustNewConstMetric(rulesInfoDesc, prometheus.GaugeValue, 1, status.Source, status.Path, status.Checksum)
+	ch <- prometheus.MustNewConstMetric(rulesLoadedDesc, prometheus.GaugeValue, float64(status.LoadedAt.UnixNano())/1e9)
+	ch <- prometheus.MustNewConstMetric(rulesCountriesDesc, prometheus.GaugeValue, float64(status.Countries))
+	ch <- prometheus.MustNewConstMetric(rulesLastErrorDesc, prometheus.GaugeValue, failed)
+}
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, batchSizes,
+		lookupResults, lookupOperators, lookupValidity, lookupFailures,
+		rulesReloads, authRejected, rulesCollector{},
+	)
+}
+
+var metricsHandler = promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+
+// MetricsHandler serves the metrics in the Prometheus text format.
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	metricsHandler.ServeHTTP(w, r)
+}
+
+// outcomeKey identifies the labelled counters a lookup result increments.
+// Rules bound the number of distinct keys, so the cache below stays small.
+type outcomeKey struct {
+	country, numberType, operator string
+}
+
+type outcomeCounters struct {
+	result, operator prometheus.Counter
+}
+
+// outcomeCache maps outcomeKey to *outcomeCounters. Resolving label values
+// on every lookup costs more than the analysis itself.
+var outcomeCache sync.Map
+
+// recordLookup counts the outcome of one analysis.
+func recordLookup(resp *LookupResponse) {
+	key := outcomeKey{resp.Country, resp.NumberType, resp.Operator}
+	cached, ok := outcomeCache.Load(key)
+	if !ok {
+		cached, _ = outcomeCache.LoadOrStore(key, &outcomeCounters{
+			result:   lookupResults.WithLabelValues(resp.Country, resp.NumberType),
+			operator: lookupOperators.WithLabelValues(resp.Country, resp.Operator),
+		})
+	}
+	counters := cached.(*outcomeCounters)
+	counters.result.Inc()
+	counters.operator.Inc()
+	if resp.Valid.isValid() {
+		lookupsValid.Inc()
+		return
+	}
+	lookupsInvalid.Inc()
+	if !resp.Valid.DigitsOnly {
+		failedDigitsOnly.Inc()
+	}
+	if !resp.Valid.KnownCountryCode {
+		failedKnownCountry.Inc()
+	}
+	if !resp.Valid.LengthOk {
+		failedLength.Inc()
+	}
+}
+
+// recordBatch observes the number of entries of a batch of the given kind.
+func recordBatch(kind string, entries int) {
+	batchSizes.WithLabelValues(kind).Observe(float64(entries))
+}
+
+// Instrument counts and times the requests served by h, labelled with the
+// ServeMux pattern that matched (e.g. "/jobs/{id}") so the number of series
+// stays bounded whatever paths clients send. h must be a ServeMux or pass
+// the request on to one unchanged.
+func Instrument(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(rec, r)
+
+		endpoint := endpointOf(r)
+		httpRequests.WithLabelValues(endpoint, r.Method, strconv.Itoa(rec.code())).Inc()
+		httpDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	})
+}
+
+// endpointOf returns the path of the ServeMux pattern that served r, or
+// "unmatched". It is only known once the mux has handled r.
+func endpointOf(r *http.Request) string {
+	endpoint := r.Pattern
+	if i := strings.IndexByte(endpoint, ' '); i >= 0 {
+		endpoint = endpoint[i+1:] // drop the method of "POST /jobs"
+	}
+	if endpoint == "" {
+		return "unmatched"
+	}
+	return endpoint
+}
+
+// statusRecorder remembers the status code written through it. Unwrap lets
+// http.ResponseController reach the underlying writer for flushing.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// code is the status sent, 200 when the handler never set one.
+func (s *statusRecorder) code() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,85 @@
+package lookup
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrapeMetrics(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	MetricsHandler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("metrics: status %d", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestMetricsCountRequestsLookupsAndBatches(t *testing.T) {
+	mux := http.NewServeMux()
+	NewAPI(nil).Register(mux)
+	mux.HandleFunc("/metrics", MetricsHandler)
+	h := Instrument(mux)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/v1/lookup?msisdn=%2B381641234567", nil),
+		httptest.NewRequest(http.MethodPost, "/v1/batch", strings.NewReader(`{"msisdns": ["+381641234567", "12ab"]}`)),
+		httptest.NewRequest(http.MethodGet, "/v1/lookup", nil),
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	out := scrapeMetrics(t)
+	for _, want := range []string{
+		`lookup_http_requests_total{code="200",endpoint="/v1/lookup",method="GET"}`,
+		`lookup_http_requests_total{code="400",endpoint="/v1/lookup",method="GET"}`,
+		`lookup_http_requests_total{code="200",endpoint="/v1/batch",method="POST"}`,
+		`lookup_http_request_duration_seconds_bucket{endpoint="/v1/batch",le="+Inf"}`,
+		`lookup_batch_size_count{kind="batch"}`,
+		`lookup_results_total{country="Serbia",number_type="mobile"}`,
+		`lookup_operator_results_total{country="Serbia",operator="Telekom Srbija (mts original range)"}`,
+		`lookup_validity_failures_total{check="digits_only"}`,
+		`lookup_rules_info{checksum="`,
+		`lookup_rules_reloads_total{result="error"}`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in the metrics output", want)
+		}
+	}
+}
+
+func TestInstrumentLabelsUnknownPathsByPattern(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	h := Instrument(mux)
+	for _, path := range []string{"/jobs/a", "/jobs/b", "/nowhere/1", "/nowhere/2"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	out := scrapeMetrics(t)
+	if !strings.Contains(out, `lookup_http_requests_total{code="404",endpoint="/jobs/{id}",method="GET"}`) ||
+		!strings.Contains(out, `lookup_http_requests_total{code="404",endpoint="unmatched",method="GET"}`) {
+		t.Fatalf("expected requests to be labelled by pattern:\n%s", out)
+	}
+	if strings.Contains(out, "/nowhere") || strings.Contains(out, "/jobs/a") {
+		t.Fatal("raw request paths must not become label values")
+	}
+}
+
+func BenchmarkAnalyzeMetrics(b *testing.B) {
+	rules := Default().currentRules()
+	b.Run("without", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			rules.resolve("+381641234567", Options{})
+		}
+	})
+	b.Run("with", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			rules.analyze("+381641234567", Options{})
+		}
+	})
+}
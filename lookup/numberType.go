@@ -1,17 +1,21 @@
 package lookup
 
 func NumberType(msisdn string) string {
+	return Default().NumberType(msisdn)
+}
+
+func (a *Analyzer) NumberType(msisdn string) string {
 	normalized := normalize(msisdn)
 	if normalized == "" {
 		return "unknown"
 	}
 
-	country, prefix := findCountryRule(normalized)
+	country, prefix := a.currentRules().findCountryRule(normalized)
 	if country == nil {
 		return "unknown"
 	}
 
 	local := normalized[len(prefix):]
-	numberType, _ := resolveType(local, country)
+	numberType, _ := country.resolveType(normalized, local)
 	return numberType
 }
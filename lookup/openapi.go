@@ -0,0 +1,19 @@
+package lookup
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec documents every JSON endpoint served by the binary. The test
+// suite checks it against the response structs so generated clients stay
+// trustworthy.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPIHandler serves the OpenAPI 3 document.
+func OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,168 @@
+package lookup
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+type openAPISchema struct {
+	Type       string                   `json:"type"`
+	Format     string                   `json:"format"`
+	Ref        string                   `json:"$ref"`
+	Items      *openAPISchema           `json:"items"`
+	Properties map[string]openAPISchema `json:"properties"`
+	Required   []string                 `json:"required"`
+}
+
+// openAPISchemas maps every component schema to the Go type it documents.
+var openAPISchemas = map[string]reflect.Type{
+	"LookupResponse":      reflect.TypeOf(LookupResponse{}),
+	"Validity":            reflect.TypeOf(Validity{}),
+	"Explain":             reflect.TypeOf(Explain{}),
+	"LookupRequest":       reflect.TypeOf(LookupRequest{}),
+	"BatchRequest":        reflect.TypeOf(BatchRequest{}),
+	"BatchResponse":       reflect.TypeOf(BatchResponse{}),
+	"LegacyBatchResponse": reflect.TypeOf(BatchResult{}),
+	"ErrorResponse":       reflect.TypeOf(ErrorResponse{}),
+	"APIError":            reflect.TypeOf(APIError{}),
+	"RulesStatus":         reflect.TypeOf(RulesStatus{}),
+	"ReloadResponse":      reflect.TypeOf(reloadResponse{}),
+	"Health":              reflect.TypeOf(Health{}),
+	"VersionInfo":         reflect.TypeOf(VersionInfo{}),
+	"BatchSummary":        reflect.TypeOf(BatchSummary{}),
+	"InvalidCounts":       reflect.TypeOf(InvalidCounts{}),
+	"Duplicate":           reflect.TypeOf(Duplicate{}),
+	"Job":                 reflect.TypeOf(Job{}),
+	"JobRecord":           reflect.TypeOf(jobRecord{}),
+	"HistoryEntry":        reflect.TypeOf(HistoryEntry{}),
+	"HistoryPage":         reflect.TypeOf(HistoryPage{}),
+}
+
+func loadOpenAPISchemas(t *testing.T) map[string]openAPISchema {
+	t.Helper()
+	var doc struct {
+		OpenAPI    string `json:"openapi"`
+		Components struct {
+			Schemas map[string]openAPISchema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Fatalf("expected an OpenAPI 3 document, got %q", doc.OpenAPI)
+	}
+	return doc.Components.Schemas
+}
+
+func TestOpenAPISpecMatchesGoTypes(t *testing.T) {
+	schemas := loadOpenAPISchemas(t)
+
+	for name := range schemas {
+		if _, ok := openAPISchemas[name]; !ok {
+			t.Errorf("schema %s is not mapped to a Go type in openAPISchemas", name)
+		}
+	}
+
+	for name, typ := range openAPISchemas {
+		schema, ok := schemas[name]
+		if !ok {
+			t.Errorf("schema %s (%s) is missing from openapi.json", name, typ)
+			continue
+		}
+
+		var required []string
+		seen := map[string]bool{}
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			tag := field.Tag.Get("json")
+			jsonName, opts, _ := strings.Cut(tag, ",")
+			if jsonName == "-" || !field.IsExported() {
+				continue
+			}
+			seen[jsonName] = true
+			if opts != "omitempty" {
+				required = append(required, jsonName)
+			}
+
+			prop, ok := schema.Properties[jsonName]
+			if !ok {
+				t.Errorf("%s.%s (json %q) is not documented", name, field.Name, jsonName)
+				continue
+			}
+			if want, got := describeGoType(field.Type), describeSchema(prop); want != got {
+				t.Errorf("%s.%s: spec says %s, Go type is %s", name, jsonName, got, want)
+			}
+		}
+		for prop := range schema.Properties {
+			if !seen[prop] {
+				t.Errorf("%s.%s is documented but not present in %s", name, prop, typ)
+			}
+		}
+
+		sort.Strings(required)
+		documented := append([]string(nil), schema.Required...)
+		sort.Strings(documented)
+		if !reflect.DeepEqual(required, documented) {
+			t.Errorf("%s: required fields %v do not match non-omitempty fields %v", name, documented, required)
+		}
+	}
+}
+
+func describeGoType(typ reflect.Type) string {
+	switch {
+	case typ.Kind() == reflect.Pointer:
+		return describeGoType(typ.Elem())
+	case typ == reflect.TypeOf(time.Time{}):
+		return "string/date-time"
+	case typ.Kind() == reflect.String:
+		return "string"
+	case typ.Kind() == reflect.Bool:
+		return "boolean"
+	case typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Uint64:
+		return "integer"
+	case typ.Kind() == reflect.Float32 || typ.Kind() == reflect.Float64:
+		return "number"
+	case typ.Kind() == reflect.Slice:
+		return "array of " + describeGoType(typ.Elem())
+	case typ.Kind() == reflect.Map:
+		return "object"
+	case typ.Kind() == reflect.Struct:
+		for name, mapped := range openAPISchemas {
+			if mapped == typ {
+				return "ref " + name
+			}
+		}
+		return "unmapped struct " + typ.String()
+	}
+	return "unsupported " + typ.String()
+}
+
+func describeSchema(s openAPISchema) string {
+	switch {
+	case s.Ref != "":
+		return "ref " + strings.TrimPrefix(s.Ref, "#/components/schemas/")
+	case s.Type == "array" && s.Items != nil:
+		return "array of " + describeSchema(*s.Items)
+	case s.Type == "string" && s.Format == "date-time":
+		return "string/date-time"
+	}
+	return s.Type
+}
+
+func TestOpenAPIHandlerServesSpec(t *testing.T) {
+	rec := httptest.NewRecorder()
+	OpenAPIHandler(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !json.Valid(rec.Body.Bytes()) {
+		t.Fatalf("served document is not valid JSON")
+	}
+}
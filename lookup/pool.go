@@ -0,0 +1,107 @@
+package lookup
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// poolChunk is how many consecutive entries a worker analyses per slot.
+// Batches of at most one chunk are analysed inline.
+const poolChunk = 64
+
+// WorkerPool analyses batch entries concurrently. Size bounds the goroutines
+// analysing entries across every batch served through the pool, PerRequest
+// caps how many of them a single batch may occupy so one large upload cannot
+// starve the others.
+type WorkerPool struct {
+	slots      chan struct{}
+	perRequest int
+}
+
+// NewWorkerPool returns a pool of size workers (GOMAXPROCS when size <= 0)
+// of which a single batch may use perRequest (all of them when <= 0).
+func NewWorkerPool(size, perRequest int) *WorkerPool {
+	if size <= 0 {
+		size = runtime.GOMAXPROCS(0)
+	}
+	if perRequest <= 0 || perRequest > size {
+		perRequest = size
+	}
+	return &WorkerPool{slots: make(chan struct{}, size), perRequest: perRequest}
+}
+
+// Size reports the server-wide worker limit.
+func (p *WorkerPool) Size() int { return cap(p.slots) }
+
+// PerRequest reports how many workers a single batch may use.
+func (p *WorkerPool) PerRequest() int { return p.perRequest }
+
+// AnalyzeAll resolves every value with a and returns the results in input
+// order. All entries see the same rules snapshot even if the analyzer is
+// reloaded meanwhile. When ctx ends first the results are incomplete and
+// ctx.Err() is returned.
+func (p *WorkerPool) AnalyzeAll(ctx context.Context, a *Analyzer, values []string, opts Options) ([]LookupResponse, error) {
+	return p.analyzeAll(ctx, a.currentRules(), values, opts)
+}
+
+func (p *WorkerPool) analyzeAll(ctx context.Context, rules *compiledRules, values []string, opts Options) ([]LookupResponse, error) {
+	results := make([]LookupResponse, len(values))
+
+	chunks := (len(values) + poolChunk - 1) / poolChunk
+	workers := min(p.perRequest, chunks)
+	if workers <= 1 {
+		for i, value := range values {
+			if i%poolChunk == 0 && ctx.Err() != nil {
+				return results, ctx.Err()
+			}
+			results[i] = rules.analyze(value, opts)
+		}
+		return results, nil
+	}
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				chunk := int(next.Add(1)) - 1
+				if chunk >= chunks {
+					return
+				}
+				select {
+				case p.slots <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				end := min((chunk+1)*poolChunk, len(values))
+				for i := chunk * poolChunk; i < end; i++ {
+					results[i] = rules.analyze(values[i], opts)
+				}
+				<-p.slots
+			}
+		}()
+	}
+	wg.Wait()
+	return results, ctx.Err()
+}
+
+var defaultPool atomic.Pointer[WorkerPool]
+
+// DefaultWorkerPool returns the pool used by the package level batch
+// handlers. Unless SetDefaultWorkerPool was called it has GOMAXPROCS workers.
+func DefaultWorkerPool() *WorkerPool {
+	if p := defaultPool.Load(); p != nil {
+		return p
+	}
+	defaultPool.CompareAndSwap(nil, NewWorkerPool(0, 0))
+	return defaultPool.Load()
+}
+
+// SetDefaultWorkerPool makes p the pool behind the package level handlers.
+func SetDefaultWorkerPool(p *WorkerPool) {
+	defaultPool.Store(p)
+}
@@ -0,0 +1,126 @@
+package lookup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// sampleBatch mixes countries, formats and invalid input.
+func sampleBatch(n int) []string {
+	samples := []string{"+393383260866", "0641234567", "+41791234567", "00381 64 123 4567", "+306971234567", "+1 202 555 0123", "12", "abc"}
+	values := make([]string, n)
+	for i := range values {
+		values[i] = samples[i%len(samples)]
+	}
+	return values
+}
+
+func TestWorkerPoolKeepsInputOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overlay.json")
+	if err := os.WriteFile(path, []byte(`{"countries": []}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := Open(Source{Path: path, Overlay: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := sampleBatch(5000)
+	opts := Options{Region: "RS"}
+	before := make([]LookupResponse, len(values))
+	for i, value := range values {
+		before[i] = a.AnalyzeWith(value, opts)
+	}
+
+	// The rules reloaded below rename the Serbian mobile operator.
+	overlay := `{"countries": [{"name": "Serbia", "codes": ["381"], "minLength": 11, "maxLength": 12,
+		"operatorRules": [{"prefix": "38164", "operator": "Reloaded mts", "mcc": "220", "mnc": "03"}]}]}`
+	if err := os.WriteFile(path, []byte(overlay), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := Open(Source{Path: path, Overlay: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := make([]LookupResponse, len(values))
+	for i, value := range values {
+		after[i] = reloaded.AnalyzeWith(value, opts)
+	}
+	if reflect.DeepEqual(before, after) {
+		t.Fatal("the reloaded rules should change some results")
+	}
+
+	pool := NewWorkerPool(4, 3)
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := pool.AnalyzeAll(context.Background(), a, values, opts)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for i := range got {
+				if !reflect.DeepEqual(got[i], before[i]) && !reflect.DeepEqual(got[i], after[i]) {
+					t.Errorf("result %d matches neither rule set: %+v", i, got[i])
+					return
+				}
+			}
+		}()
+	}
+	// reloading while batches run must not race with the workers
+	if err := a.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if got := a.Operator("+381641234567"); got != "Reloaded mts" {
+		t.Fatalf("expected the reloaded rules to be served, got %s", got)
+	}
+}
+
+func TestWorkerPoolStopsWhenContextIsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewWorkerPool(2, 2).AnalyzeAll(ctx, LoadEmbedded(), sampleBatch(1000), Options{}); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestNewWorkerPoolCapsPerRequestWorkers(t *testing.T) {
+	pool := NewWorkerPool(4, 16)
+	if pool.Size() != 4 || pool.PerRequest() != 4 {
+		t.Fatalf("expected per-request workers to be capped by the pool size, got %d/%d", pool.Size(), pool.PerRequest())
+	}
+}
+
+// BenchmarkBatch compares sequential analysis of a 10k batch with the worker
+// pool at several sizes; run with -cpu to vary GOMAXPROCS.
+func BenchmarkBatch(b *testing.B) {
+	a := LoadEmbedded()
+	values := sampleBatch(10_000)
+	opts := Options{Region: "RS"}
+
+	b.Run("sequential", func(b *testing.B) {
+		results := make([]LookupResponse, len(values))
+		for b.Loop() {
+			for i, value := range values {
+				results[i] = a.AnalyzeWith(value, opts)
+			}
+		}
+		b.ReportMetric(float64(len(values)*b.N)/b.Elapsed().Seconds(), "numbers/s")
+	})
+	for _, workers := range []int{2, 4, 8} {
+		b.Run(fmt.Sprintf("pool-%d", workers), func(b *testing.B) {
+			pool := NewWorkerPool(workers, workers)
+			for b.Loop() {
+				pool.AnalyzeAll(context.Background(), a, values, opts)
+			}
+			b.ReportMetric(float64(len(values)*b.N)/b.Elapsed().Seconds(), "numbers/s")
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package lookup
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// numberRange is a compiled From–To block of international numbers (country
+// code included). The bounds are compared against the leading digits of a
+// number, so 381641000000–381644999999 covers every 12 digit number between
+// them. Numbers must also fall within the block's length bounds, which default
+// to exactly the length of From.
+type numberRange struct {
+	start     string
+	end       string
+	from, to  uint64
+	digits    int
+	minLength int
+	maxLength int
+	label     string
+}
+
+func parseRange(from, to string, minLength, maxLength int) (numberRange, error) {
+	if !isDigits(from) || !isDigits(to) {
+		return numberRange{}, fmt.Errorf("range %s–%s must use digits only", from, to)
+	}
+	if len(from) != len(to) {
+		return numberRange{}, fmt.Errorf("range %s–%s has bounds of different length", from, to)
+	}
+	if from[0] != to[0] {
+		return numberRange{}, fmt.Errorf("range %s–%s spans more than one country code", from, to)
+	}
+	if len(from) > 19 {
+		return numberRange{}, fmt.Errorf("range %s–%s is longer than 19 digits", from, to)
+	}
+	lo, _ := strconv.ParseUint(from, 10, 64)
+	hi, _ := strconv.ParseUint(to, 10, 64)
+	if lo > hi {
+		return numberRange{}, fmt.Errorf("range %s–%s starts after it ends", from, to)
+	}
+	if minLength == 0 && maxLength == 0 {
+		minLength, maxLength = len(from), len(from)
+	}
+	if maxLength == 0 {
+		maxLength = math.MaxInt
+	}
+	if minLength < len(from) || minLength > maxLength {
+		return numberRange{}, fmt.Errorf("range %s–%s has invalid length bounds %d–%d", from, to, minLength, maxLength)
+	}
+	return numberRange{
+		start:     from,
+		end:       to,
+		from:      lo,
+		to:        hi,
+		digits:    len(from),
+		minLength: minLength,
+		maxLength: maxLength,
+		label:     from + "–" + to,
+	}, nil
+}
+
+// anchor is the prefix shared by both bounds; every number in the block
+// starts with it, so the block is indexed under that trie node.
+func (r numberRange) anchor() string {
+	return commonPrefix(r.start, r.end)
+}
+
+// contains reports whether msisdn (digits only) falls inside the block.
+func (r numberRange) contains(msisdn string) bool {
+	if len(msisdn) < r.minLength || len(msisdn) > r.maxLength {
+		return false
+	}
+	var value uint64
+	for i := 0; i < r.digits; i++ {
+		value = value*10 + uint64(msisdn[i]-'0')
+	}
+	return value >= r.from && value <= r.to
+}
+
+// coverage is how many numbers of the given length the block spans; smaller
+// means more specific.
+func (r numberRange) coverage(length int) float64 {
+	return float64(r.to-r.from+1) * math.Pow10(length-r.digits)
+}
+
+// prefixCoverage is the equivalent of coverage for a plain prefix rule.
+func prefixCoverage(prefixLen, length int) float64 {
+	return math.Pow10(length - prefixLen)
+}
+
+type operatorRange struct {
+	numberRange
+	op *operatorMetadata
+}
+
+type typeRange struct {
+	numberRange
+	rule TypeRule
+}
+
+func (r TypeRule) isRange() bool     { return r.From != "" || r.To != "" }
+func (r OperatorRule) isRange() bool { return r.From != "" || r.To != "" }
@@ -0,0 +1,23 @@
+package lookup
+
+import (
+	"sort"
+	"strings"
+)
+
+// HasRegion reports whether region is declared by any country in the rules.
+func (a *Analyzer) HasRegion(region string) bool {
+	_, ok := a.currentRules().countryByRegion[strings.ToUpper(region)]
+	return ok
+}
+
+// Regions lists the region codes usable as a default region, sorted.
+func (a *Analyzer) Regions() []string {
+	byRegion := a.currentRules().countryByRegion
+	out := make([]string, 0, len(byRegion))
+	for region := range byRegion {
+		out = append(out, region)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,126 @@
+package lookup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+)
+
+// errNotReloadable is returned when an analyzer was not built from a Source.
+var errNotReloadable = errors.New("lookup: analyzer has no rules file to reload")
+
+// Reload re-reads the analyzer's rules source and atomically swaps in the new
+// rule set. When the file cannot be read or parsed the previously loaded rules
+// stay active and the error is returned to the caller.
+func (a *Analyzer) Reload() error {
+	if a.source == nil {
+		return errNotReloadable
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	rules, err := a.source.load()
+	a.lastErr = err
+	if err != nil {
+		rulesReloadsFailed.Inc()
+		return err
+	}
+	a.rules.Store(rules)
+	rulesReloadsSucceeded.Inc()
+	return nil
+}
+
+// Watch polls the rules file every interval and reloads it whenever its size
+// or modification time changes. Reload failures are passed to onError (if set)
+// and the watcher keeps running until ctx is cancelled.
+func (a *Analyzer) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	if a.source == nil || a.source.Path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastMod, lastSize := statRules(a.source.Path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		mod, size := statRules(a.source.Path)
+		if mod.Equal(lastMod) && size == lastSize {
+			continue
+		}
+		lastMod, lastSize = mod, size
+
+		if err := a.Reload(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+func statRules(path string) (time.Time, int64) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, -1
+	}
+	return info.ModTime(), info.Size()
+}
+
+type reloadResponse struct {
+	Status    string `json:"status"`
+	Countries int    `json:"countries,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ServeReload exposes Reload as an admin HTTP endpoint.
+func (a *Analyzer) ServeReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "reload endpoint expects POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := a.Reload(); err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(reloadResponse{Status: "rejected", Error: err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(reloadResponse{
+		Status:    "reloaded",
+		Countries: a.currentRules().countries,
+	})
+}
+
+// ReloadRules reloads the default analyzer. See Analyzer.Reload.
+func ReloadRules() error {
+	return Default().Reload()
+}
+
+// WatchRules watches the default analyzer's rules file. See Analyzer.Watch.
+func WatchRules(ctx context.Context, interval time.Duration, onError func(error)) {
+	Default().Watch(ctx, interval, onError)
+}
+
+// ReloadHandler exposes reloading of the default analyzer over HTTP.
+func ReloadHandler(w http.ResponseWriter, r *http.Request) {
+	Default().ServeReload(w, r)
+}
+
+// ServeStatus reports the active rules source, checksum and load state.
+func (a *Analyzer) ServeStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.Status())
+}
+
+// StatusHandler reports the default analyzer's rules status over HTTP.
+func StatusHandler(w http.ResponseWriter, r *http.Request) {
+	Default().ServeStatus(w, r)
+}
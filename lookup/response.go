@@ -26,6 +26,7 @@ type Validity struct {
 
 // Explain contains human readable rules that were applied.
 type Explain struct {
+	Input    string `json:"input,omitempty"`
 	Country  string `json:"country"`
 	Type     string `json:"type"`
 	Operator string `json:"operator"`
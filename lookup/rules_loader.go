@@ -4,32 +4,67 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
-	"sync"
+	"strings"
 )
 
-type ruleSet struct {
+// RuleSet is the document stored in rules.json.
+type RuleSet struct {
 	Countries []CountryRule `json:"countries"`
 }
 
+// clone deep-copies the rule slices so a compiled rule set never shares
+// memory with a caller owned RuleSet.
+func (s RuleSet) clone() RuleSet {
+	out := RuleSet{Countries: make([]CountryRule, len(s.Countries))}
+	for i, country := range s.Countries {
+		country.Codes = append([]string(nil), country.Codes...)
+		country.Regions = append([]string(nil), country.Regions...)
+		country.TypeRules = append([]TypeRule(nil), country.TypeRules...)
+		country.OperatorRules = append([]OperatorRule(nil), country.OperatorRules...)
+		out.Countries[i] = country
+	}
+	return out
+}
+
 type CountryRule struct {
-	Name          string         `json:"name"`
-	Codes         []string       `json:"codes"`
-	MinLength     int            `json:"minLength"`
-	MaxLength     int            `json:"maxLength"`
-	TypeRules     []TypeRule     `json:"typeRules"`
-	OperatorRules []OperatorRule `json:"operatorRules"`
+	Name      string   `json:"name"`
+	Codes     []string `json:"codes"`
+	MinLength int      `json:"minLength"`
+	MaxLength int      `json:"maxLength"`
+	// Regions are the ISO 3166-1 alpha-2 codes that dial with this
+	// country's conventions, e.g. ["RS"]. TrunkPrefix is dropped from
+	// national numbers ("0" in RS, none in IT) and InternationalPrefix is
+	// dialled before a foreign country code ("00", "011" in US).
+	Regions             []string       `json:"regions,omitempty"`
+	TrunkPrefix         string         `json:"trunkPrefix,omitempty"`
+	InternationalPrefix string         `json:"internationalPrefix,omitempty"`
+	TypeRules           []TypeRule     `json:"typeRules"`
+	OperatorRules       []OperatorRule `json:"operatorRules"`
 }
 
+// TypeRule maps numbers to a type either by a prefix of the local number
+// (after the country code) or by an inclusive From–To block of full
+// international numbers. MinLength/MaxLength restrict a block to numbers of
+// that length and default to the length of From.
 type TypeRule struct {
 	Prefix      string `json:"prefix"`
+	From        string `json:"from,omitempty"`
+	To          string `json:"to,omitempty"`
+	MinLength   int    `json:"minLength,omitempty"`
+	MaxLength   int    `json:"maxLength,omitempty"`
 	Type        string `json:"type"`
 	Explanation string `json:"explanation"`
 }
 
+// OperatorRule maps numbers to an operator either by a prefix of the full
+// international number or by an inclusive From–To block, with the same length
+// semantics as TypeRule.
 type OperatorRule struct {
 	Prefix      string `json:"prefix"`
+	From        string `json:"from,omitempty"`
+	To          string `json:"to,omitempty"`
+	MinLength   int    `json:"minLength,omitempty"`
+	MaxLength   int    `json:"maxLength,omitempty"`
 	Operator    string `json:"operator"`
 	Explanation string `json:"explanation"`
 	MCC         string `json:"mcc"`
@@ -43,106 +78,171 @@ type operatorMetadata struct {
 	MNC         string
 }
 
-var (
-	loadOnce             sync.Once
-	loadErr              error
-	countryByPrefix      map[string]*CountryRule
-	maxCountryPrefixLen  int
-	operatorByPrefix     map[string]*operatorMetadata
-	maxOperatorPrefixLen int
-)
+// compiledRules is an immutable snapshot of the prefix indexes. A new
+// snapshot is built on every (re)load and swapped in atomically, so readers
+// never observe a half-updated rule set.
+type compiledRules struct {
+	countries       int
+	operators       int
+	countryTrie     digitTrie[*countryIndex]
+	countryByRegion map[string]*countryIndex
+	warnings        []ruleWarning
+	status          RulesStatus
+}
 
-func init() {
-	loadOnce.Do(func() {
-		loadErr = loadRuleData()
-	})
-	if loadErr != nil {
-		panic(loadErr)
-	}
+// countryIndex pairs a country with the operator rules declared inside it,
+// so operator rules are only ever matched within the resolved country.
+type countryIndex struct {
+	*CountryRule
+	// operators holds prefix rules at the node of their prefix and range
+	// blocks at the node of the prefix shared by their bounds.
+	operators  digitTrie[operatorEntry]
+	typeRanges digitTrie[[]typeRange]
+	// dialCode is the code prepended to national numbers of the country.
+	dialCode string
 }
 
-func loadRuleData() error {
-	data, err := os.ReadFile(resolveRulesPath())
-	if err != nil {
-		return fmt.Errorf("lookup: unable to load rules: %w", err)
-	}
+type operatorEntry struct {
+	prefix *operatorMetadata
+	ranges []operatorRange
+}
 
-	var set ruleSet
+func (c *countryIndex) regionLabel(region string) string {
+	return fmt.Sprintf("%s (%s)", strings.ToUpper(region), c.Name)
+}
+
+func compileRules(data []byte) (*compiledRules, error) {
+	var set RuleSet
 	if err := json.Unmarshal(data, &set); err != nil {
-		return fmt.Errorf("lookup: unable to parse rules: %w", err)
+		return nil, fmt.Errorf("lookup: unable to parse rules: %w", err)
 	}
+	return compileRuleSet(set)
+}
 
-	tmpCountryByPrefix := make(map[string]*CountryRule)
-	tmpOperatorByPrefix := make(map[string]*operatorMetadata)
-	tmpMaxCountryPrefixLen := 0
-	tmpMaxOperatorPrefixLen := 0
+func compileRuleSet(set RuleSet) (*compiledRules, error) {
+	rules, conflicts := buildRules(set)
+	if len(conflicts) > 0 {
+		return nil, &RuleConflictError{Conflicts: conflicts}
+	}
+	if len(rules.countryTrie.values) == 0 {
+		return nil, errors.New("lookup: no country prefixes loaded")
+	}
+	return rules, nil
+}
+
+// countryBuild keeps the flat per-country maps used to detect duplicates
+// while the tries are being filled.
+type countryBuild struct {
+	index    *countryIndex
+	prefixes map[string]*operatorMetadata
+	ranges   []operatorRange
+}
+
+// buildRules compiles set, skipping and reporting every rule that is
+// malformed or collides with an earlier one.
+func buildRules(set RuleSet) (*compiledRules, []string) {
+	rules := &compiledRules{
+		countries:       len(set.Countries),
+		countryByRegion: make(map[string]*countryIndex),
+	}
+	codes := make(map[string]*countryIndex)
+	builds := make([]*countryBuild, 0, len(set.Countries))
+	var conflicts []string
 
 	for i := range set.Countries {
 		country := &set.Countries[i]
+		build := &countryBuild{
+			index:    &countryIndex{CountryRule: country},
+			prefixes: make(map[string]*operatorMetadata),
+		}
+		index := build.index
+		builds = append(builds, build)
+		rules.operators += len(country.OperatorRules)
+
 		for _, code := range country.Codes {
 			if code == "" {
 				continue
 			}
-			tmpCountryByPrefix[code] = country
-			if l := len(code); l > tmpMaxCountryPrefixLen {
-				tmpMaxCountryPrefixLen = l
+			if !isDigits(code) {
+				conflicts = append(conflicts, fmt.Sprintf("%s: country code %q is not numeric", country.Name, code))
+				continue
+			}
+			if other, ok := codes[code]; ok {
+				conflicts = append(conflicts, describeDuplicate("country code "+code, other.Name, country.Name))
+				continue
+			}
+			codes[code] = index
+			*rules.countryTrie.slot(code) = index
+			if index.dialCode == "" {
+				index.dialCode = code
 			}
 		}
-		for _, opRule := range country.OperatorRules {
-			if opRule.Prefix == "" {
+		for _, region := range country.Regions {
+			region = strings.ToUpper(region)
+			if other, ok := rules.countryByRegion[region]; ok {
+				conflicts = append(conflicts, describeDuplicate("region "+region, other.Name, country.Name))
 				continue
 			}
-			tmpOperatorByPrefix[opRule.Prefix] = &operatorMetadata{
+			if index.dialCode != "" {
+				rules.countryByRegion[region] = index
+			}
+		}
+		for _, typeRule := range country.TypeRules {
+			if !typeRule.isRange() {
+				continue
+			}
+			block, err := parseRange(typeRule.From, typeRule.To, typeRule.MinLength, typeRule.MaxLength)
+			if err != nil {
+				conflicts = append(conflicts, fmt.Sprintf("%s: type %s", country.Name, err))
+				continue
+			}
+			slot := index.typeRanges.slot(block.anchor())
+			*slot = append(*slot, typeRange{numberRange: block, rule: typeRule})
+		}
+
+		seenRanges := make(map[numberRange]string)
+		for _, opRule := range country.OperatorRules {
+			op := &operatorMetadata{
 				Name:        opRule.Operator,
 				Explanation: opRule.Explanation,
 				MCC:         opRule.MCC,
 				MNC:         opRule.MNC,
 			}
-			if l := len(opRule.Prefix); l > tmpMaxOperatorPrefixLen {
-				tmpMaxOperatorPrefixLen = l
+			if opRule.isRange() {
+				block, err := parseRange(opRule.From, opRule.To, opRule.MinLength, opRule.MaxLength)
+				if err != nil {
+					conflicts = append(conflicts, fmt.Sprintf("%s: operator %s (%s)", country.Name, err, opRule.Operator))
+					continue
+				}
+				if other, ok := seenRanges[block]; ok {
+					conflicts = append(conflicts, fmt.Sprintf("%s: %s", country.Name,
+						describeDuplicate("operator range "+block.label, other, opRule.Operator)))
+					continue
+				}
+				seenRanges[block] = opRule.Operator
+				entry := index.operators.slot(block.anchor())
+				entry.ranges = append(entry.ranges, operatorRange{numberRange: block, op: op})
+				build.ranges = append(build.ranges, operatorRange{numberRange: block, op: op})
+				continue
 			}
-		}
-	}
-
-	if len(tmpCountryByPrefix) == 0 {
-		return errors.New("lookup: no country prefixes loaded")
-	}
-
-	countryByPrefix = tmpCountryByPrefix
-	operatorByPrefix = tmpOperatorByPrefix
-	maxCountryPrefixLen = tmpMaxCountryPrefixLen
-	maxOperatorPrefixLen = tmpMaxOperatorPrefixLen
-	return nil
-}
-
-func resolveRulesPath() string {
-	if envPath := os.Getenv("LOOKUP_RULES_PATH"); envPath != "" {
-		if _, err := os.Stat(envPath); err == nil {
-			return envPath
-		}
-	}
-
-	candidates := []string{
-		"rules.json",
-		filepath.Join("lookup", "rules.json"),
-	}
-
-	for _, path := range candidates {
-		if _, err := os.Stat(path); err == nil {
-			return path
-		}
-	}
-
-	// fallback to executable directory
-	if exe, err := os.Executable(); err == nil {
-		if dir := filepath.Dir(exe); dir != "" {
-			candidate := filepath.Join(dir, "rules.json")
-			if _, err := os.Stat(candidate); err == nil {
-				return candidate
+			if opRule.Prefix == "" {
+				continue
+			}
+			if !isDigits(opRule.Prefix) {
+				conflicts = append(conflicts, fmt.Sprintf("%s: operator prefix %s (%s) is not numeric", country.Name, opRule.Prefix, opRule.Operator))
+				continue
+			}
+			if other, ok := build.prefixes[opRule.Prefix]; ok {
+				conflicts = append(conflicts, fmt.Sprintf("%s: %s", country.Name,
+					describeDuplicate("operator prefix "+opRule.Prefix, other.Name, opRule.Operator)))
+				continue
 			}
+			build.prefixes[opRule.Prefix] = op
+			entry := index.operators.slot(opRule.Prefix)
+			entry.prefix = op
 		}
 	}
 
-	// default to repo-relative path to trigger useful error later
-	return filepath.Join("lookup", "rules.json")
+	rules.warnings = rules.shadowedOperators(builds, codes)
+	return rules, conflicts
 }
@@ -0,0 +1,169 @@
+package lookup
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// embeddedRules is the rule set compiled into the binary, so the service can
+// always start even when no rules file is deployed next to it.
+//
+//go:embed rules.json
+var embeddedRules []byte
+
+// Source selects where an analyzer loads its rules from.
+type Source struct {
+	// Path is an external rules file. When empty only the embedded rules
+	// are used.
+	Path string
+	// Overlay merges the file on top of the embedded rules instead of
+	// replacing them: countries with the same name are swapped out, new
+	// countries are added.
+	Overlay bool
+}
+
+// SourceFromEnv reads the rules source from LOOKUP_RULES_PATH and
+// LOOKUP_RULES_MODE ("replace", the default, or "overlay").
+func SourceFromEnv() Source {
+	return Source{
+		Path:    os.Getenv("LOOKUP_RULES_PATH"),
+		Overlay: strings.EqualFold(os.Getenv("LOOKUP_RULES_MODE"), "overlay"),
+	}
+}
+
+func (s Source) mode() string {
+	switch {
+	case s.Path == "":
+		return "embedded"
+	case s.Overlay:
+		return "overlay"
+	default:
+		return "file"
+	}
+}
+
+// Open builds an Analyzer from src. File backed sources can later be
+// refreshed with Reload or Watch.
+func Open(src Source) (*Analyzer, error) {
+	rules, err := src.load()
+	if err != nil {
+		return nil, err
+	}
+	return newAnalyzer(rules, &src), nil
+}
+
+// LoadEmbedded builds an Analyzer from the rules compiled into the binary.
+func LoadEmbedded() *Analyzer {
+	a, err := Open(Source{})
+	if err != nil {
+		// the embedded rules are linted by the test suite
+		panic(err)
+	}
+	return a
+}
+
+func (s Source) load() (*compiledRules, error) {
+	if s.Path == "" {
+		rules, err := compileRules(embeddedRules)
+		if err != nil {
+			return nil, err
+		}
+		rules.status = newRulesStatus(s, embeddedRules)
+		return rules, nil
+	}
+
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("lookup: unable to load rules: %w", err)
+	}
+
+	var rules *compiledRules
+	if s.Overlay {
+		rules, err = compileOverlay(embeddedRules, data)
+	} else {
+		rules, err = compileRules(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w (%s)", err, s.Path)
+	}
+	rules.status = newRulesStatus(s, data)
+	return rules, nil
+}
+
+// compileOverlay merges the countries of overlay into base. A country in the
+// overlay replaces the base country with the same name; others are appended.
+func compileOverlay(base, overlay []byte) (*compiledRules, error) {
+	var baseSet, overlaySet RuleSet
+	if err := json.Unmarshal(base, &baseSet); err != nil {
+		return nil, fmt.Errorf("lookup: unable to parse embedded rules: %w", err)
+	}
+	if err := json.Unmarshal(overlay, &overlaySet); err != nil {
+		return nil, fmt.Errorf("lookup: unable to parse rules: %w", err)
+	}
+
+	byName := make(map[string]int, len(baseSet.Countries))
+	for i, country := range baseSet.Countries {
+		byName[country.Name] = i
+	}
+	for _, country := range overlaySet.Countries {
+		if i, ok := byName[country.Name]; ok {
+			baseSet.Countries[i] = country
+			continue
+		}
+		byName[country.Name] = len(baseSet.Countries)
+		baseSet.Countries = append(baseSet.Countries, country)
+	}
+
+	return compileRuleSet(baseSet)
+}
+
+// RulesStatus describes the rule set an analyzer is currently serving.
+type RulesStatus struct {
+	Source           string    `json:"source"`
+	Path             string    `json:"path,omitempty"`
+	Checksum         string    `json:"checksum"`
+	EmbeddedChecksum string    `json:"embeddedChecksum,omitempty"`
+	LoadedAt         time.Time `json:"loadedAt"`
+	Countries        int       `json:"countries"`
+	Operators        int       `json:"operators"`
+	Warnings         []string  `json:"warnings,omitempty"`
+	LastError        string    `json:"lastError,omitempty"`
+}
+
+func newRulesStatus(src Source, data []byte) RulesStatus {
+	status := RulesStatus{
+		Source:   src.mode(),
+		Path:     src.Path,
+		Checksum: checksum(data),
+		LoadedAt: time.Now().UTC(),
+	}
+	if src.Overlay && src.Path != "" {
+		status.EmbeddedChecksum = checksum(embeddedRules)
+	}
+	return status
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Status reports where the active rules came from and whether the last
+// reload attempt failed.
+func (a *Analyzer) Status() RulesStatus {
+	rules := a.currentRules()
+	status := rules.status
+	status.Countries = rules.countries
+	status.Operators = rules.operators
+	status.Warnings = a.Warnings()
+	if err := a.LastError(); err != nil {
+		status.LastError = err.Error()
+	}
+	return status
+}
@@ -0,0 +1,182 @@
+package lookup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// maxStreamLine bounds a single input line; the body itself is unbounded.
+	maxStreamLine = 64 << 10
+	// streamFlushEvery is how many results are buffered before a flush.
+	streamFlushEvery = 256
+	// streamIdleTimeout bounds each read of the body and each write of the
+	// response of BatchStream. It replaces the server's ReadTimeout and
+	// WriteTimeout, which would cut long streams off.
+	streamIdleTimeout = time.Minute
+)
+
+// StreamBatch reads numbers from in, one per line, and writes one NDJSON
+// LookupResponse per number to out as soon as it is resolved, so memory use
+// does not grow with the input. A line is either a bare number, a JSON string
+// or a LookupRequest object whose region overrides opts. Blank lines are
+// skipped; a line that cannot be used produces an ErrorResponse line carrying
+// its line number instead of aborting the stream.
+//
+// flush, when set, is called after every few results. StreamBatch stops when
+// ctx is cancelled or out fails and returns the number of results written.
+func (a *Analyzer) StreamBatch(ctx context.Context, in io.Reader, out io.Writer, opts Options, flush func()) (int, error) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 4096), maxStreamLine)
+
+	bw := bufio.NewWriter(out)
+	enc := json.NewEncoder(bw)
+	written, line := 0, 0
+	for scanner.Scan() {
+		line++
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var payload any
+		req, err := parseStreamLine(text, opts.Region)
+		switch {
+		case err != nil:
+			payload = streamError(line, "invalid_line", err.Error(), "")
+		case req.Region != "" && !a.HasRegion(req.Region):
+			payload = streamError(line, "unknown_region", "region is not defined in the rules", "region")
+		case strings.TrimSpace(req.MSISDN) == "":
+			payload = streamError(line, "missing_parameter", "msisdn is required", "msisdn")
+		default:
+			payload = a.AnalyzeWith(req.MSISDN, Options{Region: req.Region})
+		}
+		if err := enc.Encode(payload); err != nil {
+			return written, err
+		}
+		written++
+
+		if written%streamFlushEvery == 0 {
+			if err := bw.Flush(); err != nil {
+				return written, err
+			}
+			if flush != nil {
+				flush()
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			err = fmt.Errorf("line %d is longer than %d bytes", line+1, maxStreamLine)
+		}
+		enc.Encode(streamError(line+1, "invalid_line", err.Error(), ""))
+		bw.Flush()
+		return written, err
+	}
+	if err := bw.Flush(); err != nil {
+		return written, err
+	}
+	if flush != nil {
+		flush()
+	}
+	return written, nil
+}
+
+func parseStreamLine(text []byte, region string) (LookupRequest, error) {
+	req := LookupRequest{Region: region}
+	switch text[0] {
+	case '{':
+		dec := json.NewDecoder(bytes.NewReader(text))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			return req, fmt.Errorf("unable to decode line: %w", err)
+		}
+		if req.Region == "" {
+			req.Region = region
+		}
+	case '"':
+		if err := json.Unmarshal(text, &req.MSISDN); err != nil {
+			return req, fmt.Errorf("unable to decode line: %w", err)
+		}
+	default:
+		req.MSISDN = string(text)
+	}
+	return req, nil
+}
+
+func streamError(line int, code, message, field string) ErrorResponse {
+	return ErrorResponse{Error: APIError{Code: code, Message: message, Field: field, Line: line}}
+}
+
+// BatchStream handles POST /v1/batch/stream. The body is newline-delimited
+// numbers or NDJSON of any size; the response is NDJSON written while the
+// body is still being read. Cancelling the request stops the work.
+func (api *API) BatchStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "batch stream expects POST", "")
+		return
+	}
+
+	region := r.URL.Query().Get("region")
+	if !api.checkRegion(w, region) {
+		return
+	}
+
+	// Results are written before the body is fully read.
+	rc := http.NewResponseController(w)
+	rc.EnableFullDuplex()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	in := deadlineReader{r.Body, rc}
+	out := deadlineWriter{w, rc}
+	n, _ := api.analyzer().StreamBatch(r.Context(), in, out, Options{Region: region}, func() {
+		out.extend()
+		rc.Flush()
+	})
+	recordBatch("stream", n)
+	noteBatch(r.Context(), n)
+}
+
+// deadlineReader and deadlineWriter push the connection's deadline forward
+// before every chunk, so only a client that stalls for streamIdleTimeout is
+// cut off, however long the whole stream takes.
+type deadlineReader struct {
+	io.Reader
+	rc *http.ResponseController
+}
+
+func (d deadlineReader) Read(p []byte) (int, error) {
+	d.rc.SetReadDeadline(time.Now().Add(streamIdleTimeout))
+	return d.Reader.Read(p)
+}
+
+type deadlineWriter struct {
+	io.Writer
+	rc *http.ResponseController
+}
+
+func (d deadlineWriter) Write(p []byte) (int, error) {
+	d.extend()
+	return d.Writer.Write(p)
+}
+
+func (d deadlineWriter) extend() {
+	d.rc.SetWriteDeadline(time.Now().Add(streamIdleTimeout))
+}
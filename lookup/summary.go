@@ -0,0 +1,155 @@
+package lookup
+
+import (
+	"context"
+	"strings"
+)
+
+// BatchSummary aggregates the results of a batch.
+type BatchSummary struct {
+	// Entries is the number of non-blank inputs, Analyzed how many of them
+	// were looked up (fewer when duplicates were removed).
+	Entries  int `json:"entries"`
+	Analyzed int `json:"analyzed"`
+	Valid    int `json:"valid"`
+	// Invalid counts analysed numbers failing at least one Validity check,
+	// broken down by check.
+	Invalid     InvalidCounts  `json:"invalid"`
+	Countries   map[string]int `json:"countries"`
+	NumberTypes map[string]int `json:"numberTypes"`
+	Operators   map[string]int `json:"operators"`
+	// Networks is keyed by "MCC/MNC"; numbers without an MCC are left out.
+	Networks   map[string]int `json:"networks"`
+	Duplicates []Duplicate    `json:"duplicates"`
+}
+
+// InvalidCounts breaks invalid entries down by the failed Validity check. An
+// entry failing several checks is counted under each of them.
+type InvalidCounts struct {
+	Total            int `json:"total"`
+	DigitsOnly       int `json:"digitsOnly"`
+	KnownCountryCode int `json:"knownCountryCode"`
+	LengthOk         int `json:"lengthOk"`
+}
+
+// Duplicate is a number that appears more than once once normalized, with
+// the 1-based input lines and the raw inputs of every occurrence.
+type Duplicate struct {
+	E164   string   `json:"e164"`
+	Lines  []int    `json:"lines"`
+	Inputs []string `json:"inputs"`
+}
+
+// batchEntry is a non-blank batch input and its 1-based position in the
+// original input.
+type batchEntry struct {
+	line  int
+	value string
+}
+
+// numberedBatchList trims values and drops blank ones, remembering the
+// position of each entry.
+func numberedBatchList(values []string) []batchEntry {
+	entries := make([]batchEntry, 0, len(values))
+	for i, value := range values {
+		if trimmed := strings.TrimSpace(value); trimmed != "" {
+			entries = append(entries, batchEntry{line: i + 1, value: trimmed})
+		}
+	}
+	return entries
+}
+
+// batchRun is an analysed batch: entries are the inputs that were looked up
+// and results[i] belongs to entries[i].
+type batchRun struct {
+	entries []batchEntry
+	results []LookupResponse
+	summary BatchSummary
+}
+
+// runBatch analyses entries on pool and summarises them. Duplicates are
+// detected on the normalized number (region applied); with dedupe only the
+// first occurrence of each number is analysed.
+func runBatch(ctx context.Context, pool *WorkerPool, a *Analyzer, entries []batchEntry, opts Options, dedupe bool) (batchRun, error) {
+	rules := a.currentRules()
+
+	groups := make(map[string][]int, len(entries))
+	var order []string
+	analysed := make([]batchEntry, 0, len(entries))
+	for i, entry := range entries {
+		norm, _ := rules.prepare(entry.value, opts)
+		first := true
+		if key := norm.digits; key != "" {
+			_, seen := groups[key]
+			if first = !seen; first {
+				order = append(order, key)
+			}
+			groups[key] = append(groups[key], i)
+		}
+		if first || !dedupe {
+			analysed = append(analysed, entry)
+		}
+	}
+
+	recordBatch("batch", len(entries))
+	noteBatch(ctx, len(entries))
+	values := make([]string, len(analysed))
+	for i, entry := range analysed {
+		values[i] = entry.value
+	}
+	results, err := pool.analyzeAll(ctx, rules, values, opts)
+	if err != nil {
+		return batchRun{}, err
+	}
+
+	summary := summarize(results)
+	summary.Entries = len(entries)
+	summary.Duplicates = []Duplicate{}
+	for _, key := range order {
+		indexes := groups[key]
+		if len(indexes) < 2 {
+			continue
+		}
+		dup := Duplicate{E164: "+" + key}
+		for _, i := range indexes {
+			dup.Lines = append(dup.Lines, entries[i].line)
+			dup.Inputs = append(dup.Inputs, entries[i].value)
+		}
+		summary.Duplicates = append(summary.Duplicates, dup)
+	}
+	return batchRun{entries: analysed, results: results, summary: summary}, nil
+}
+
+func summarize(results []LookupResponse) BatchSummary {
+	summary := BatchSummary{
+		Analyzed:    len(results),
+		Countries:   map[string]int{},
+		NumberTypes: map[string]int{},
+		Operators:   map[string]int{},
+		Networks:    map[string]int{},
+	}
+	for _, res := range results {
+		summary.Countries[res.Country]++
+		summary.NumberTypes[res.NumberType]++
+		summary.Operators[res.Operator]++
+		if res.MCC != "" {
+			summary.Networks[res.MCC+"/"+res.MNC]++
+		}
+
+		if res.Valid.isValid() {
+			summary.Valid++
+			continue
+		}
+		summary.Invalid.Total++
+		if !res.Valid.DigitsOnly {
+			summary.Invalid.DigitsOnly++
+		}
+		if !res.Valid.KnownCountryCode {
+			summary.Invalid.KnownCountryCode++
+		}
+		if !res.Valid.LengthOk {
+			summary.Invalid.LengthOk++
+		}
+	}
+	return summary
+}
@@ -0,0 +1,90 @@
+package lookup
+
+// digitTrie is a longest-prefix index over strings of ASCII digits. Nodes
+// live in a single slice and refer to their children by position, so lookups
+// walk at most len(key) nodes without allocating. Node 0 is the root and can
+// therefore double as the "no child" marker.
+type digitTrie[T any] struct {
+	nodes  []trieNode
+	values []T
+}
+
+type trieNode struct {
+	next [10]int32
+	// value is the position in values plus one; zero means no value ends
+	// at this node.
+	value int32
+}
+
+// slot returns a pointer to the value stored under key, creating it (and any
+// missing nodes) when needed. key must consist of ASCII digits. The pointer is
+// only valid until the next call to slot.
+func (t *digitTrie[T]) slot(key string) *T {
+	if len(t.nodes) == 0 {
+		t.nodes = append(t.nodes, trieNode{})
+	}
+	node := int32(0)
+	for i := 0; i < len(key); i++ {
+		d := key[i] - '0'
+		next := t.nodes[node].next[d]
+		if next == 0 {
+			next = int32(len(t.nodes))
+			t.nodes = append(t.nodes, trieNode{})
+			t.nodes[node].next[d] = next
+		}
+		node = next
+	}
+	if t.nodes[node].value == 0 {
+		var zero T
+		t.values = append(t.values, zero)
+		t.nodes[node].value = int32(len(t.values))
+	}
+	return &t.values[t.nodes[node].value-1]
+}
+
+// longest returns the value stored under the longest prefix of key and the
+// length of that prefix.
+func (t *digitTrie[T]) longest(key string) (value T, depth int, ok bool) {
+	if len(t.nodes) == 0 {
+		return value, 0, false
+	}
+	node := int32(0)
+	for i := 0; i < len(key); i++ {
+		node = t.child(node, key[i])
+		if node == 0 {
+			break
+		}
+		if v := t.nodes[node].value; v != 0 {
+			value, depth, ok = t.values[v-1], i+1, true
+		}
+	}
+	return value, depth, ok
+}
+
+// child returns the node reached from node by digit c, or 0 when there is
+// none (including for non-digit input).
+func (t *digitTrie[T]) child(node int32, c byte) int32 {
+	if c < '0' || c > '9' || int(node) >= len(t.nodes) {
+		return 0
+	}
+	return t.nodes[node].next[c-'0']
+}
+
+// valueAt returns the value stored at node, or nil.
+func (t *digitTrie[T]) valueAt(node int32) *T {
+	if v := t.nodes[node].value; v != 0 {
+		return &t.values[v-1]
+	}
+	return nil
+}
+
+// commonPrefix returns the longest shared prefix of a and b.
+func commonPrefix(a, b string) string {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return a[:i]
+		}
+	}
+	return a[:n]
+}
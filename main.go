@@ -1,39 +1,87 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"lookup/lookup"
-	"lookup/web"
-	"net/http"
+	"os"
+	"strings"
 )
 
-func main() {
-
-	http.HandleFunc("/", web.IndexHandler)
-	http.HandleFunc("/lookup", lookup.Handler)
-	http.HandleFunc("/lookup-view", web.LookupViewHandler)
-	http.HandleFunc("/batch", lookup.BatchHandler)
+const usage = `usage: msisdn-lookup <command> [arguments]
 
-	const addr = ":9090"
-	fmt.Println("Listening on", addr)
-	http.ListenAndServe(addr, nil)
+Commands:
+  serve    run the HTTP server (default when no command is given)
+  lookup   analyse one or more numbers
+  batch    analyse a file of numbers offline
+  rules    check a rules file
+  config   print the effective server configuration
+  health   check that the configured server is ready
 
-	fmt.Println(lookup.Country("+393383260866")) // Italy
-	fmt.Println(lookup.Country("+38164123456"))  // Serbia
-	fmt.Println(lookup.Country("+38598123456"))  // Croatia
+Run "msisdn-lookup <command> -h" for the flags of a command.
+`
 
-	fmt.Println(lookup.NumberType("+393383260866")) // mobile
-	fmt.Println(lookup.NumberType("+390636918899")) // fixed
-	fmt.Println(lookup.NumberType("+38164123456"))  // mobile
-	fmt.Println(lookup.NumberType("+38111345678"))  // fixed
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
 
-	fmt.Println(lookup.IsValidLength("+393383260866")) // true  (Italy)
-	fmt.Println(lookup.IsValidLength("+390636918899")) // true  (Italy fixed)
+// run dispatches to a subcommand and returns the process exit code: 0 on
+// success, 1 when the command found invalid input (or failed), 2 on usage
+// errors.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "--help" {
+		// bare flags keep starting the server as before
+		return runServe(args, stdout, stderr)
+	}
 
-	fmt.Println(lookup.IsValidLength("+38164123456")) // true  (Serbia mobile)
-	fmt.Println(lookup.IsValidLength("+38111345678")) // true  (Serbia fixed)
+	switch args[0] {
+	case "serve":
+		return runServe(args[1:], stdout, stderr)
+	case "lookup":
+		return runLookup(args[1:], stdout, stderr)
+	case "batch":
+		return runBatch(args[1:], os.Stdin, stdout, stderr)
+	case "rules":
+		return runRules(args[1:], stdout, stderr)
+	case "config":
+		return runConfig(args[1:], stdout, stderr)
+	case "health":
+		return runHealth(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+}
 
-	fmt.Println(lookup.IsValidLength("+393"))  // false
-	fmt.Println(lookup.IsValidLength("+3816")) // false
+// rulesFlags registers -rules and -rules-overlay on fs, defaulting to
+// SourceFromEnv.
+func rulesFlags(fs *flag.FlagSet) *lookup.Source {
+	src := lookup.SourceFromEnv()
+	fs.StringVar(&src.Path, "rules", src.Path, "external rules file (default: embedded rules, env LOOKUP_RULES_PATH)")
+	fs.BoolVar(&src.Overlay, "rules-overlay", src.Overlay, "merge the rules file on top of the embedded rules (env LOOKUP_RULES_MODE=overlay)")
+	return &src
+}
 
+// parseInterspersed parses fs allowing flags after positional arguments and
+// returns the positional ones.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
 }
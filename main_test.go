@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLookupExitCodeReflectsValidity(t *testing.T) {
+	cases := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"lookup", "+393383260866"}, 0},
+		{[]string{"lookup", "0641234567", "--region", "RS", "+41791234567"}, 0},
+		{[]string{"lookup", "+393383260866", "+3816"}, 1},
+		{[]string{"lookup"}, 2},
+		{[]string{"lookup", "--region", "ZZ", "064"}, 2},
+		{[]string{"nope"}, 2},
+	}
+	for _, tc := range cases {
+		var stdout, stderr bytes.Buffer
+		if code := run(tc.args, &stdout, &stderr); code != tc.code {
+			t.Errorf("%v: exit %d, want %d (stderr %q)", tc.args, code, tc.code, stderr.String())
+		}
+	}
+}
+
+func TestBatchConvertsCSVToNDJSON(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	in := strings.NewReader("name;msisdn\nana;0641234567\nivan;+41791234567\n")
+	code := runBatch([]string{"--format", "ndjson", "--region", "RS"}, in, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	var first struct{ E164 string }
+	if len(lines) != 2 || json.Unmarshal([]byte(lines[0]), &first) != nil || first.E164 != "+381641234567" {
+		t.Fatalf("unexpected output %q", stdout.String())
+	}
+
+	stdout.Reset()
+	if code := runBatch(nil, strings.NewReader("+393383260866\n12\n"), &stdout, &stderr); code != 1 {
+		t.Fatalf("a batch with invalid numbers should exit 1, got %d", code)
+	}
+}
+
+func TestWithPathPrefixServesBelowPrefix(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rules/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	})
+	h := withPathPrefix("/msisdn", mux)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/msisdn/rules/status", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "/rules/status" {
+		t.Fatalf("prefixed route: %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/msisdn", nil))
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/msisdn/" {
+		t.Fatalf("bare prefix: %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rules/status", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unprefixed route: %d", rec.Code)
+	}
+}
+
+func TestHealthProbesTheConfiguredAddrAndPrefix(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/msisdn/readyz" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"health", "-addr", addr, "-path-prefix", "/msisdn"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit %d, want 0 (stderr %q)", code, stderr.String())
+	}
+	if code := run([]string{"health", "-addr", addr}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "404") {
+		t.Fatalf("exit %d, want 1 for a missing prefix (stderr %q)", code, stderr.String())
+	}
+	if url, _ := readyURL(":9090", ""); url != "http://127.0.0.1:9090/readyz" {
+		t.Fatalf("a wildcard addr should be reached on loopback, got %s", url)
+	}
+}
+
+func TestServeFailsWhenPortIsTaken(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"serve", "-addr", ln.Addr().String(), "-watch-rules=false", "-reload=false"}
+	if code := run(args, &stdout, &stderr); code != 1 {
+		t.Fatalf("exit %d, want 1 (stderr %q)", code, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "unable to listen") {
+		t.Fatalf("expected the listen error to be logged, got %q", stderr.String())
+	}
+}
+
+func TestServeDrainsInFlightRequestsOnShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	drained := false
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, server, ln, 5*time.Second, slog.New(slog.NewTextHandler(io.Discard, nil)),
+			func(context.Context) error { drained = true; return nil })
+	}()
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+
+	<-started
+	stop()
+	time.Sleep(50 * time.Millisecond)
+	if _, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+		t.Fatal("listener should be closed once shutdown starts")
+	}
+	close(release)
+
+	if got := <-body; got != "done" {
+		t.Fatalf("in-flight request got %q, want it to complete", got)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	if !drained {
+		t.Fatal("drain functions should run during shutdown")
+	}
+}
+
+func TestServeReportsRequestsOutlivingTheDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, server, ln, 50*time.Millisecond, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	}()
+	go http.Get("http://" + ln.Addr().String() + "/stuck")
+
+	<-started
+	stop()
+	if err := <-served; err == nil || !strings.Contains(err.Error(), "requests still running") {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+
+	"lookup/lookup"
+)
+
+// historyView is the data of the history page.
+type historyView struct {
+	Query url.Values // the filter as submitted, to fill the form again
+	Page  lookup.HistoryPage
+	Error string
+}
+
+// HistoryHandler renders the lookups recorded by the default history,
+// filtered by the query parameters /v1/history accepts.
+func HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	history := lookup.DefaultHistory()
+	if history == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	view := historyView{Query: r.URL.Query()}
+	status := http.StatusOK
+	if filter, err := lookup.ParseHistoryFilter(view.Query); err != nil {
+		view.Error, status = err.Error(), http.StatusBadRequest
+	} else {
+		view.Page = history.Query(filter)
+	}
+	render(w, status, pages["history"], "layout", view)
+}
@@ -0,0 +1,104 @@
+package web
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// staticFiles holds the UI's stylesheet and script so the page works
+// without reaching any other host.
+//
+//go:embed static
+var staticFiles embed.FS
+
+// contentSecurityPolicy only allows resources from the server itself; inline
+// scripts and styles are refused.
+const contentSecurityPolicy = "default-src 'self'; script-src 'self'; style-src 'self'; img-src 'self' data:; " +
+	"connect-src 'self'; object-src 'none'; base-uri 'none'; form-action 'self'; frame-ancestors 'none'"
+
+type asset struct {
+	name string // e.g. "app.css"
+	hash string
+	body []byte
+}
+
+// assets maps the hashed name ("app.3f9a0c21d4e5.css") of every embedded file
+// to its content; assetNames maps the plain name to the hashed one.
+var assets, assetNames = loadAssets()
+
+func loadAssets() (map[string]asset, map[string]string) {
+	byHash, names := map[string]asset{}, map[string]string{}
+	entries, err := fs.ReadDir(staticFiles, "static")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		body, err := staticFiles.ReadFile("static/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		sum := sha256.Sum256(body)
+		a := asset{name: entry.Name(), hash: hex.EncodeToString(sum[:])[:12], body: body}
+		ext := path.Ext(a.name)
+		hashed := strings.TrimSuffix(a.name, ext) + "." + a.hash + ext
+		byHash[hashed] = a
+		names[a.name] = hashed
+	}
+	return byHash, names
+}
+
+// assetURL returns the relative URL of an embedded file; it changes whenever
+// the file does, so browsers may cache it forever.
+func assetURL(name string) string {
+	hashed, ok := assetNames[name]
+	if !ok {
+		panic("web: no embedded asset " + name)
+	}
+	return "static/" + hashed
+}
+
+// StaticHandler serves the embedded assets below /static/. Hashed names are
+// immutable and cached for a year; plain names are served too (for scripts
+// that hard-code them) but must be revalidated.
+func StaticHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/static/")
+	a, hashed := assets[name]
+	if !hashed {
+		if plain, ok := assetNames[name]; ok {
+			a = assets[plain]
+		} else {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	etag := `"` + a.hash + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if hashed {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(a.name)))
+	w.Write(a.body)
+}
+
+// setPageHeaders marks a response as an HTML page or fragment under the
+// content security policy.
+func setPageHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", contentSecurityPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Referrer-Policy", "same-origin")
+}
@@ -0,0 +1,153 @@
+(function() {
+    const storageKey = 'lookupRecent';
+    const recentList = document.getElementById('recent-items');
+    const msisdnInput = document.getElementById('msisdn');
+    const singleForm = document.getElementById('single-form');
+    const result = document.getElementById('result');
+    const batchForm = document.getElementById('batch-form');
+    const batchResult = document.getElementById('batch-result');
+    const exportJsonBtn = document.getElementById('export-json');
+    const exportCsvBtn = document.getElementById('export-csv');
+    const exportXlsxBtn = document.getElementById('export-xlsx');
+    const batchFile = document.getElementById('batch-file');
+    let lastBatchResults = [];
+
+    document.addEventListener('click', (evt) => {
+        const copyBtn = evt.target.closest('[data-copy]');
+        if (copyBtn) {
+            const value = copyBtn.getAttribute('data-copy') || '';
+            const defaultLabel = copyBtn.dataset.defaultLabel || 'Copy';
+            copyToClipboard(value).then(() => {
+                copyBtn.textContent = 'Copied!';
+                setTimeout(() => copyBtn.textContent = defaultLabel, 1200);
+            }).catch(() => {
+                alert('Clipboard blocked by browser. Please copy manually.');
+            });
+        }
+        const recentBtn = evt.target.closest('.recent-item');
+        if (recentBtn) {
+            msisdnInput.value = recentBtn.getAttribute('data-value');
+            msisdnInput.focus();
+        }
+    });
+
+    singleForm.addEventListener('submit', async (evt) => {
+        evt.preventDefault();
+        const query = new URLSearchParams(new FormData(singleForm));
+        const res = await fetch(singleForm.getAttribute('action') + '?' + query);
+        result.innerHTML = await res.text();
+        const card = result.querySelector('.result-card');
+        const payload = card && card.dataset.json ? JSON.parse(card.dataset.json) : null;
+        if (payload) {
+            pushRecent(payload);
+            renderRecent();
+        }
+    });
+
+    batchForm.addEventListener('submit', async (evt) => {
+        evt.preventDefault();
+        const payload = document.getElementById('batch-input').value;
+        if (!payload.trim() && !batchFile.files.length) {
+            alert('Please paste at least one MSISDN or choose a CSV file');
+            return;
+        }
+        const region = document.getElementById('batch-region').value.trim();
+        const url = region ? 'batch-view?region=' + encodeURIComponent(region) : 'batch-view';
+        const res = await fetch(url, {
+            method: 'POST',
+            body: new FormData(batchForm)
+        });
+        batchResult.classList.remove('hidden');
+        batchResult.innerHTML = await res.text();
+        const view = batchResult.querySelector('.batch-view');
+        lastBatchResults = view && view.dataset.json ? JSON.parse(view.dataset.json) : [];
+        exportJsonBtn.disabled = lastBatchResults.length === 0;
+        exportCsvBtn.disabled = lastBatchResults.length === 0;
+        exportXlsxBtn.disabled = lastBatchResults.length === 0;
+    });
+
+    exportJsonBtn.addEventListener('click', () => {
+        if (!lastBatchResults.length) return;
+        copyToClipboard(JSON.stringify(lastBatchResults, null, 2)).then(() => {
+            exportJsonBtn.textContent = 'JSON copied';
+            setTimeout(() => exportJsonBtn.textContent = 'Copy JSON', 1500);
+        }).catch(() => alert('Clipboard blocked by browser.'));
+    });
+
+    [exportCsvBtn, exportXlsxBtn].forEach((btn) => btn.addEventListener('click', async () => {
+        const form = new FormData(batchForm);
+        form.set('format', btn.dataset.format);
+        const res = await fetch('batch/export', { method: 'POST', body: form });
+        if (!res.ok) {
+            alert('Export error: ' + await res.text());
+            return;
+        }
+        const link = document.createElement('a');
+        link.href = URL.createObjectURL(await res.blob());
+        link.download = 'lookup-results.' + btn.dataset.format;
+        document.body.appendChild(link);
+        link.click();
+        document.body.removeChild(link);
+        URL.revokeObjectURL(link.href);
+    }));
+
+    function copyToClipboard(value) {
+        return new Promise((resolve, reject) => {
+            if (navigator.clipboard && window.isSecureContext) {
+                navigator.clipboard.writeText(value).then(resolve).catch(reject);
+                return;
+            }
+            const textarea = document.createElement('textarea');
+            textarea.value = value;
+            textarea.style.position = 'fixed';
+            textarea.style.opacity = '0';
+            document.body.appendChild(textarea);
+            textarea.focus();
+            textarea.select();
+            try {
+                const successful = document.execCommand('copy');
+                document.body.removeChild(textarea);
+                successful ? resolve() : reject();
+            } catch (err) {
+                document.body.removeChild(textarea);
+                reject(err);
+            }
+        });
+    }
+
+    function pushRecent(payload) {
+        const list = JSON.parse(window.localStorage.getItem(storageKey) || '[]');
+        const filtered = list.filter(item => item.input !== payload.input);
+        filtered.unshift({
+            input: payload.input,
+            country: payload.country,
+            operator: payload.operator
+        });
+        window.localStorage.setItem(storageKey, JSON.stringify(filtered.slice(0, 10)));
+    }
+
+    function renderRecent() {
+        const list = JSON.parse(window.localStorage.getItem(storageKey) || '[]');
+        recentList.replaceChildren();
+        if (!list.length) {
+            const empty = document.createElement('li');
+            empty.className = 'muted';
+            empty.textContent = 'No history yet.';
+            recentList.appendChild(empty);
+            return;
+        }
+        list.forEach((item) => {
+            // Stored values come from user input: never parse them as HTML.
+            const button = document.createElement('button');
+            button.type = 'button';
+            button.className = 'recent-item';
+            button.dataset.value = item.input;
+            button.textContent = item.input + ' · ' + (item.country || 'Unknown');
+            const li = document.createElement('li');
+            li.appendChild(button);
+            recentList.appendChild(li);
+        });
+    }
+
+    renderRecent();
+})();
@@ -0,0 +1,55 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestIndexUsesOnlyEmbeddedAssets(t *testing.T) {
+	rec := httptest.NewRecorder()
+	IndexHandler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	page := rec.Body.String()
+
+	if csp := rec.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "script-src 'self'") || strings.Contains(csp, "unsafe-inline") {
+		t.Fatalf("unexpected CSP %q", csp)
+	}
+	if strings.Contains(page, "https://") || strings.Contains(page, "<script>") || strings.Contains(page, "<style>") || strings.Contains(page, "style=") {
+		t.Fatal("the page must not load remote resources or carry inline scripts and styles")
+	}
+
+	refs := regexp.MustCompile(`(?:href|src)="(static/[^"]+)"`).FindAllStringSubmatch(page, -1)
+	if len(refs) != 2 {
+		t.Fatalf("expected the stylesheet and the script, got %v", refs)
+	}
+	for _, ref := range refs {
+		rec := httptest.NewRecorder()
+		StaticHandler(rec, httptest.NewRequest(http.MethodGet, "/"+ref[1], nil))
+		if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "public, max-age=31536000, immutable" {
+			t.Fatalf("%s: %d %q", ref[1], rec.Code, rec.Header().Get("Cache-Control"))
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/"+ref[1], nil)
+		req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+		rec = httptest.NewRecorder()
+		StaticHandler(rec, req)
+		if rec.Code != http.StatusNotModified {
+			t.Fatalf("%s: expected 304 for a matching ETag, got %d", ref[1], rec.Code)
+		}
+	}
+}
+
+func TestStaticHandlerServesPlainNamesUncached(t *testing.T) {
+	rec := httptest.NewRecorder()
+	StaticHandler(rec, httptest.NewRequest(http.MethodGet, "/static/app.js", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "no-cache" || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/javascript") {
+		t.Fatalf("plain name: %d %v", rec.Code, rec.Header())
+	}
+	rec = httptest.NewRecorder()
+	StaticHandler(rec, httptest.NewRequest(http.MethodGet, "/static/app.000000000000.js", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown hash: %d", rec.Code)
+	}
+}
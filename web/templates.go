@@ -0,0 +1,124 @@
+package web
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+	"sort"
+
+	"lookup/lookup"
+)
+
+// templateFiles holds the page layout, one file per page and the partials
+// that render results.
+//
+//go:embed templates
+var templateFiles embed.FS
+
+var templateFuncs = template.FuncMap{
+	"asset":           assetURL,
+	"inc":             func(i int) int { return i + 1 },
+	"orNA":            orNA,
+	"confidence":      confidenceBadge,
+	"numberTypeClass": numberTypeClass,
+	"valid": func(v lookup.Validity) bool {
+		return v.DigitsOnly && v.KnownCountryCode && v.LengthOk
+	},
+}
+
+// partials is the layout plus every partial; pages are parsed on top of a
+// copy of it so each one can define its own "content".
+var partials = template.Must(template.New("").Funcs(templateFuncs).ParseFS(templateFiles,
+	"templates/layout.html", "templates/partials/*.html"))
+
+var pages = map[string]*template.Template{
+	"index":   page("index.html"),
+	"history": page("history.html"),
+}
+
+func page(file string) *template.Template {
+	return template.Must(template.Must(partials.Clone()).ParseFS(templateFiles, "templates/"+file))
+}
+
+// render executes the named template of set with data. Output is buffered,
+// so a failing template answers 500 instead of half a page.
+func render(w http.ResponseWriter, status int, set *template.Template, name string, data any) {
+	var buf bytes.Buffer
+	if err := set.ExecuteTemplate(&buf, name, data); err != nil {
+		http.Error(w, "unable to render page", http.StatusInternalServerError)
+		return
+	}
+	setPageHeaders(w)
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+func orNA(s string) string {
+	if s == "" {
+		return "N/A"
+	}
+	return s
+}
+
+var confidenceBadges = map[string]string{
+	"high":   "✅ High",
+	"medium": "🟡 Medium",
+	"low":    "🟠 Low",
+}
+
+func confidenceBadge(level string) string {
+	if badge, ok := confidenceBadges[level]; ok {
+		return badge
+	}
+	return level
+}
+
+func numberTypeClass(numberType string) string {
+	switch numberType {
+	case "mobile", "fixed":
+		return numberType
+	}
+	return "invalid"
+}
+
+// summaryGroup is one line of the batch summary, e.g. the count of results
+// per country, largest first.
+type summaryGroup struct {
+	Title  string
+	Counts []summaryCount
+}
+
+type summaryCount struct {
+	Key   string
+	Count int
+}
+
+func summaryGroups(summary lookup.BatchSummary) []summaryGroup {
+	var groups []summaryGroup
+	for _, group := range []struct {
+		title  string
+		counts map[string]int
+	}{
+		{"Countries", summary.Countries},
+		{"Types", summary.NumberTypes},
+		{"Operators", summary.Operators},
+		{"MCC/MNC", summary.Networks},
+	} {
+		if len(group.counts) == 0 {
+			continue
+		}
+		counts := make([]summaryCount, 0, len(group.counts))
+		for key, count := range group.counts {
+			counts = append(counts, summaryCount{Key: key, Count: count})
+		}
+		sort.Slice(counts, func(i, j int) bool {
+			if counts[i].Count != counts[j].Count {
+				return counts[i].Count > counts[j].Count
+			}
+			return counts[i].Key < counts[j].Key
+		})
+		groups = append(groups, summaryGroup{Title: group.title, Counts: counts})
+	}
+	return groups
+}
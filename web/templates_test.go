@@ -0,0 +1,94 @@
+package web
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"lookup/lookup"
+)
+
+func TestLookupViewEscapesInput(t *testing.T) {
+	rec := httptest.NewRecorder()
+	LookupViewHandler(rec, httptest.NewRequest(http.MethodGet, "/lookup-view?msisdn=%2B381641234567%3Cb%3E", nil))
+	card := rec.Body.String()
+	if strings.Contains(card, "<b>") || !strings.Contains(card, "&lt;b&gt;") {
+		t.Fatalf("input not escaped:\n%s", card)
+	}
+	if !strings.Contains(card, `<span class="badge invalid">Needs attention</span>`) {
+		t.Fatalf("expected the failed digits check:\n%s", card)
+	}
+
+	rec = httptest.NewRecorder()
+	LookupViewHandler(rec, httptest.NewRequest(http.MethodGet, "/lookup-view?msisdn=1&region=%3Cx%3E", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "alert error") || strings.Contains(body, "<x>") {
+		t.Fatalf("unexpected region error:\n%s", body)
+	}
+}
+
+func TestBatchViewRendersSummaryAndTable(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/batch-view", strings.NewReader("+381641234567\n+393383260866\n<i>\n+381641234567"))
+	rec := httptest.NewRecorder()
+	BatchViewHandler(rec, req)
+	view := rec.Body.String()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d:\n%s", rec.Code, view)
+	}
+	if rows := strings.Count(view, "<tr><td>"); rows != 4 {
+		t.Fatalf("expected 4 rows, got %d:\n%s", rows, view)
+	}
+	if strings.Contains(view, "<i>") || !strings.Contains(view, "Duplicates:") || !strings.Contains(view, "on lines 1, 4") {
+		t.Fatalf("unexpected view:\n%s", view)
+	}
+
+	attr := regexp.MustCompile(`data-json="([^"]*)"`).FindStringSubmatch(view)
+	var results []map[string]any
+	if attr == nil || json.Unmarshal([]byte(html.UnescapeString(attr[1])), &results) != nil || len(results) != 4 {
+		t.Fatalf("results not embedded: %v", attr)
+	}
+
+	rec = httptest.NewRecorder()
+	BatchViewHandler(rec, httptest.NewRequest(http.MethodPost, "/batch-view", strings.NewReader(" ")))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "alert error") {
+		t.Fatalf("expected an error card, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestHistoryPageListsRecordedLookups(t *testing.T) {
+	history, err := lookup.OpenHistory(lookup.HistoryConfig{Path: filepath.Join(t.TempDir(), "history.jsonl")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer history.Close()
+	lookup.SetHistory(history)
+	defer lookup.SetHistory(nil)
+
+	for _, msisdn := range []string{"%2B381641234567", "%3Cb%3E12"} {
+		LookupViewHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/lookup-view?msisdn="+msisdn, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	HistoryHandler(rec, httptest.NewRequest(http.MethodGet, "/history?valid=true&country=%3Cscript%3E", nil))
+	page := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(page, "0 matching lookups") || strings.Contains(page, "<script") {
+		t.Fatalf("unexpected filtered page %d:\n%s", rec.Code, page)
+	}
+
+	rec = httptest.NewRecorder()
+	HistoryHandler(rec, httptest.NewRequest(http.MethodGet, "/history?valid=true", nil))
+	page = rec.Body.String()
+	if !strings.Contains(page, "1 matching lookups") || !strings.Contains(page, "&#43;381*******67") || !strings.Contains(page, `<option value="true" selected>`) {
+		t.Fatalf("unexpected page:\n%s", page)
+	}
+
+	rec = httptest.NewRecorder()
+	HistoryHandler(rec, httptest.NewRequest(http.MethodGet, "/history?limit=0", nil))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "alert error") {
+		t.Fatalf("expected a bad limit to be rejected, got %d", rec.Code)
+	}
+}